@@ -3,9 +3,14 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"clipnest/internal/config"
 	"clipnest/internal/socket"
@@ -26,7 +31,13 @@ func main() {
 		return
 	}
 
-	client, err := socket.NewClient(config.GetSocketPath())
+	cfg, err := config.Load("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	client, err := socket.NewClient(cfg.SocketPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\nIs clipnestd running?\n", err)
 		os.Exit(1)
@@ -35,33 +46,65 @@ func main() {
 
 	switch cmd {
 	case "list":
+		usage := "Usage: clipnest list [limit] [--sort frecency|recent|pinned-first] [--tag <tag>]"
+		flags, args, err := takeFlags(os.Args[2:], "--sort", "--tag")
+		if err != nil || len(args) > 1 {
+			exitUsage(err, usage)
+		}
 		limit := 20
-		if len(os.Args) > 2 {
-			if l, err := strconv.Atoi(os.Args[2]); err == nil && l > 0 {
+		if len(args) > 0 {
+			if l, err := strconv.Atoi(args[0]); err == nil && l > 0 {
 				limit = l
 			}
 		}
 		sendAndPrintList(client, socket.SocketMessage{
 			Type: "list",
-			Data: map[string]interface{}{"limit": limit},
+			Data: map[string]interface{}{"limit": limit, "sort": flags["--sort"], "tag": flags["--tag"]},
 		})
 
 	case "search":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: clipnest search <query>")
-			os.Exit(1)
+		usage := "Usage: clipnest search [--sort frecency|recent|pinned-first] [--] <query>"
+		flags, args, err := takeFlags(os.Args[2:], "--sort")
+		if err != nil || len(args) == 0 {
+			exitUsage(err, usage)
 		}
 		sendAndPrintList(client, socket.SocketMessage{
 			Type: "search",
-			Data: map[string]interface{}{"query": os.Args[2], "limit": 20},
+			Data: map[string]interface{}{"query": strings.Join(args, " "), "limit": 20, "sort": flags["--sort"]},
 		})
 
 	case "pins":
 		sendAndPrintList(client, socket.SocketMessage{Type: "pins"})
 
 	case "copy":
-		if len(os.Args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: clipnest copy <id>")
+		args := os.Args[2:]
+		primary := len(args) > 0 && args[0] == "--primary"
+		if primary {
+			args = args[1:]
+		}
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "Usage: clipnest copy [--primary] <id>")
+			os.Exit(1)
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid id")
+			os.Exit(1)
+		}
+		var copied socket.CopyClipData
+		request(client, socket.SocketMessage{
+			Type: "copy_clip",
+			Data: map[string]interface{}{"id": id, "primary": primary},
+		}, &copied)
+		if copied.ClearAt > 0 {
+			fmt.Printf("OK, clearing it at %s (clipnest keep to cancel)\n", time.Unix(copied.ClearAt, 0).Format("15:04:05"))
+		} else {
+			fmt.Println("OK")
+		}
+
+	case "expire":
+		if len(os.Args) != 4 {
+			fmt.Fprintln(os.Stderr, "Usage: clipnest expire <id> <duration>|never (e.g. 2h, 7d)")
 			os.Exit(1)
 		}
 		id, err := strconv.ParseInt(os.Args[2], 10, 64)
@@ -69,9 +112,41 @@ func main() {
 			fmt.Fprintln(os.Stderr, "Error: invalid id")
 			os.Exit(1)
 		}
+		var ttl time.Duration
+		if os.Args[3] != "never" {
+			ttl, err = config.ParseDuration(os.Args[3])
+			if err != nil || ttl <= 0 {
+				fmt.Fprintln(os.Stderr, "Usage: clipnest expire <id> <duration>|never (e.g. 2h, 7d)")
+				os.Exit(1)
+			}
+		}
 		sendAndPrintStatus(client, socket.SocketMessage{
-			Type: "copy_clip",
-			Data: map[string]interface{}{"id": id},
+			Type: "expire",
+			Data: socket.ExpireCommand{ID: id, TTLMS: ttl.Milliseconds()},
+		})
+
+	case "keep":
+		var canceled socket.CancelClearData
+		request(client, socket.SocketMessage{Type: "cancel_clear"}, &canceled)
+		if canceled.Canceled == 0 {
+			fmt.Println("Nothing scheduled to be cleared")
+		} else {
+			fmt.Println("OK, the clipboard won't be cleared")
+		}
+
+	case "sensitive":
+		if len(os.Args) < 3 || len(os.Args) > 4 || (len(os.Args) == 4 && os.Args[3] != "on" && os.Args[3] != "off") {
+			fmt.Fprintln(os.Stderr, "Usage: clipnest sensitive <id> [on|off]")
+			os.Exit(1)
+		}
+		id, err := strconv.ParseInt(os.Args[2], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid id")
+			os.Exit(1)
+		}
+		sendAndPrintStatus(client, socket.SocketMessage{
+			Type: "set_sensitive",
+			Data: socket.SetSensitiveCommand{ID: id, Sensitive: len(os.Args) == 3 || os.Args[3] == "on"},
 		})
 
 	case "pin":
@@ -104,8 +179,213 @@ func main() {
 			Data: map[string]interface{}{"id": id},
 		})
 
+	case "tag", "untag":
+		if len(os.Args) < 3 || (cmd == "tag" && len(os.Args) < 4) {
+			if cmd == "tag" {
+				fmt.Fprintln(os.Stderr, "Usage: clipnest tag <id> <tag>[,<tag>...]")
+			} else {
+				fmt.Fprintln(os.Stderr, "Usage: clipnest untag <id> [<tag>[,<tag>...]]")
+			}
+			os.Exit(1)
+		}
+		id, err := strconv.ParseInt(os.Args[2], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid id")
+			os.Exit(1)
+		}
+		var clip socket.ClipData
+		request(client, socket.SocketMessage{
+			Type: cmd,
+			Data: socket.TagCommand{ID: id, Tags: splitTags(os.Args[3:])},
+		}, &clip)
+		if len(clip.Tags) == 0 {
+			fmt.Printf("Clip %d has no tags\n", clip.ID)
+		} else {
+			fmt.Printf("Clip %d: #%s\n", clip.ID, strings.Join(clip.Tags, " #"))
+		}
+
+	case "tags":
+		var tags socket.TagListData
+		request(client, socket.SocketMessage{Type: "tags"}, &tags)
+		if len(tags.Tags) == 0 {
+			fmt.Println("No tags yet.")
+		}
+		for _, tag := range tags.Tags {
+			fmt.Printf("%-20s %s\n", tag.Name, pluralClips(tag.Count))
+		}
+
+	case "image":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: clipnest image <id> [file]")
+			os.Exit(1)
+		}
+		id, err := strconv.ParseInt(os.Args[2], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid id")
+			os.Exit(1)
+		}
+		var img socket.ImageData
+		request(client, socket.SocketMessage{
+			Type: "get_image",
+			Data: map[string]interface{}{"id": id},
+		}, &img)
+		if len(os.Args) > 3 {
+			if err := os.WriteFile(os.Args[3], img.Data, 0600); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Saved %dx%d image to %s\n", img.Width, img.Height, os.Args[3])
+			return
+		}
+		_, _ = os.Stdout.Write(img.Data)
+
+	case "show":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: clipnest show <id> [--mime <type>]")
+			os.Exit(1)
+		}
+		id, err := strconv.ParseInt(os.Args[2], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid id")
+			os.Exit(1)
+		}
+		mime := ""
+		if len(os.Args) > 3 {
+			if len(os.Args) != 5 || os.Args[3] != "--mime" {
+				fmt.Fprintln(os.Stderr, "Usage: clipnest show <id> [--mime <type>]")
+				os.Exit(1)
+			}
+			mime = os.Args[4]
+		}
+		var format socket.FormatData
+		request(client, socket.SocketMessage{
+			Type: "get_format",
+			Data: map[string]interface{}{"id": id, "mime": mime},
+		}, &format)
+		_, _ = os.Stdout.Write(format.Data)
+
+	case "rm":
+		args := os.Args[2:]
+		data := map[string]interface{}{}
+		if len(args) == 2 && (args[0] == "--query" || args[0] == "-q") {
+			data["query"] = args[1]
+		} else if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			ids := make([]int64, len(args))
+			for i, arg := range args {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid id %q\n", arg)
+					os.Exit(1)
+				}
+				ids[i] = id
+			}
+			data["ids"] = ids
+		} else {
+			fmt.Fprintln(os.Stderr, "Usage: clipnest rm <id>... | clipnest rm --query <query>")
+			os.Exit(1)
+		}
+		var removed socket.ClipRemovedData
+		request(client, socket.SocketMessage{Type: "delete", Data: data}, &removed)
+		if ids, ok := data["ids"].([]int64); ok {
+			reportMissing(ids, removed.IDs)
+			if len(removed.IDs) == 0 {
+				os.Exit(1)
+			}
+		}
+		fmt.Printf("Removed %s\n", pluralClips(len(removed.IDs)))
+
 	case "clear":
-		sendAndPrintStatus(client, socket.SocketMessage{Type: "clear"})
+		keepPins := false
+		for _, arg := range os.Args[2:] {
+			if arg != "--keep-pins" {
+				fmt.Fprintln(os.Stderr, "Usage: clipnest clear [--keep-pins]")
+				os.Exit(1)
+			}
+			keepPins = true
+		}
+		var removed socket.ClipRemovedData
+		request(client, socket.SocketMessage{
+			Type: "clear",
+			Data: map[string]interface{}{"keep_pinned": keepPins},
+		}, &removed)
+		fmt.Printf("Removed %s\n", pluralClips(len(removed.IDs)))
+
+	case "trash":
+		var trash socket.TrashListData
+		request(client, socket.SocketMessage{Type: "trash"}, &trash)
+		if len(trash.Clips) == 0 {
+			fmt.Println("Trash is empty.")
+		}
+		for _, clip := range trash.Clips {
+			printClip(clip.ClipData, time.Unix(clip.RemovedAt, 0), "["+clip.Reason+"] ", nil)
+		}
+
+	case "restore":
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: clipnest restore <id>")
+			os.Exit(1)
+		}
+		id, err := strconv.ParseInt(os.Args[2], 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: invalid id")
+			os.Exit(1)
+		}
+		var clip socket.ClipData
+		request(client, socket.SocketMessage{
+			Type: "restore",
+			Data: map[string]interface{}{"id": id},
+		}, &clip)
+		fmt.Printf("Restored clip %d\n", clip.ID)
+
+	case "undo":
+		var restored socket.ClipListData
+		request(client, socket.SocketMessage{Type: "undo"}, &restored)
+		fmt.Printf("Restored %s\n", pluralClips(restored.Count))
+
+	case "stats":
+		var stats socket.StatsData
+		request(client, socket.SocketMessage{Type: "stats"}, &stats)
+		printStats(stats)
+
+	case "pause":
+		var pause socket.PauseCommand
+		if len(os.Args) > 2 {
+			duration, err := config.ParseDuration(os.Args[2])
+			if err != nil || duration <= 0 {
+				fmt.Fprintln(os.Stderr, "Usage: clipnest pause [duration] (e.g. 10m, 1h30m)")
+				os.Exit(1)
+			}
+			pause.DurationMS = duration.Milliseconds()
+		}
+		var status socket.CaptureStatusData
+		request(client, socket.SocketMessage{Type: "pause", Data: pause}, &status)
+		printCaptureStatus(status)
+
+	case "resume":
+		var status socket.CaptureStatusData
+		request(client, socket.SocketMessage{Type: "resume"}, &status)
+		printCaptureStatus(status)
+
+	case "rules":
+		if len(os.Args) < 4 || os.Args[2] != "test" {
+			fmt.Fprintln(os.Stderr, "Usage: clipnest rules test <text>|-")
+			os.Exit(1)
+		}
+		text := strings.Join(os.Args[3:], " ")
+		if text == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			text = string(data)
+		}
+		var verdict socket.RulesTestData
+		request(client, socket.SocketMessage{
+			Type: "test_rules",
+			Data: socket.TestRulesCommand{Text: text},
+		}, &verdict)
+		printVerdict(verdict)
 
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
@@ -163,22 +443,312 @@ func sendAndPrintList(client *socket.Client, msg socket.SocketMessage) {
 	}
 
 	for _, clip := range clipList.Clips {
-		pin := " "
-		if clip.Pinned {
-			pin = "*"
-		}
-		ts := time.Unix(clip.Timestamp, 0).Format("15:04:05")
-		content := clip.Content
-		if len(content) > 80 {
-			content = content[:77] + "..."
-		}
-		// Replace newlines for single-line display
-		for i, c := range content {
-			if c == '\n' || c == '\r' {
-				content = content[:i] + "\\n" + content[i+1:]
+		var highlight []int
+		if stdoutIsTerminal() {
+			highlight = clip.MatchPositions
+		}
+		printClip(clip, time.Unix(clip.Timestamp, 0), "", highlight)
+	}
+}
+
+// ANSI escapes that turn bold text on and off
+const (
+	ansiBold  = "\x1b[1m"
+	ansiReset = "\x1b[0m"
+)
+
+// stdoutIsTerminal reports whether output goes to a terminal rather than a
+// pipe or file, where escape codes would be noise
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printClip prints one clip on a line, stamped with at and preceded by note,
+// then its file list for a files clip. Characters at highlight are in bold.
+func printClip(clip socket.ClipData, at time.Time, note string, highlight []int) {
+	pin := " "
+	if clip.Pinned {
+		pin = "*"
+	}
+	fmt.Printf("[%s] %-4d %s  %s%s\n", pin, clip.ID, at.Format("15:04:05"), note, clipSummary(clip, highlight))
+	if clip.Type == "files" {
+		printFiles(clip.Files)
+	}
+}
+
+// takeFlags takes every "<flag> <value>" (or "<flag>=<value>") of flags out of
+// args, wherever it appears, and returns the values by flag with the other
+// arguments. Any other --flag is an error; after a lone "--" nothing is.
+func takeFlags(args []string, flags ...string) (map[string]string, []string, error) {
+	values := make(map[string]string)
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return values, append(rest, args[i+1:]...), nil
+		}
+		if !strings.HasPrefix(arg, "--") {
+			rest = append(rest, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !slices.Contains(flags, name) {
+			return nil, nil, fmt.Errorf("unknown flag %s", name)
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("%s needs a value", name)
 			}
+			i++
+			value = args[i]
+		}
+		values[name] = value
+	}
+	return values, rest, nil
+}
+
+// exitUsage reports err, if any, and usage, and exits
+func exitUsage(err error, usage string) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	fmt.Fprintln(os.Stderr, usage)
+	os.Exit(1)
+}
+
+// splitTags splits tag arguments on commas and whitespace, so "work,sql" and
+// "work sql" name the same two tags
+func splitTags(args []string) []string {
+	var tags []string
+	for _, arg := range args {
+		tags = append(tags, strings.FieldsFunc(arg, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})...)
+	}
+	return tags
+}
+
+// clipSummary describes a clip in one line of about 80 characters, with the
+// characters at highlight (indexes into its content) in bold
+func clipSummary(clip socket.ClipData, highlight []int) string {
+	var tags []string
+	if clip.Captures > 1 {
+		tags = append(tags, fmt.Sprintf("[captured %dx]", clip.Captures))
+	}
+	if clip.Copies > 0 {
+		tags = append(tags, fmt.Sprintf("[used %dx]", clip.Copies))
+	}
+	if clip.ExpiresAt > 0 {
+		left := time.Until(time.Unix(clip.ExpiresAt, 0)).Round(time.Second)
+		tags = append(tags, fmt.Sprintf("[expires in %s]", max(left, 0)))
+	}
+	if clip.Sensitive {
+		tags = append(tags, "[sensitive]")
+	}
+	if clip.Source == "primary" {
+		tags = append(tags, "[primary]")
+	}
+	for _, tag := range clip.Tags {
+		tags = append(tags, "#"+tag)
+	}
+
+	content := clip.Content
+	if clip.Type == "image" {
+		content, highlight = fmt.Sprintf("[image %dx%d]", clip.Width, clip.Height), nil
+	} else if clip.Type == "files" {
+		content, highlight = fmt.Sprintf("[%d files]", len(clip.Files)), nil
+		if len(clip.Files) == 1 {
+			content = "[1 file]"
+		}
+	} else if len(clip.Formats) > 0 {
+		tags = append(tags, "[+"+strings.Join(clip.Formats, ",")+"]")
+	}
+
+	prefix := ""
+	if len(tags) > 0 {
+		prefix = strings.Join(tags, " ") + " "
+	}
+	return prefix + abbreviate(content, 80-utf8.RuneCountInString(prefix), highlight)
+}
+
+// abbreviate cuts text to width characters with "...", shows newlines as \n
+// and makes the characters at highlight bold
+func abbreviate(text string, width int, highlight []int) string {
+	runes := []rune(text)
+	suffix := ""
+	if len(runes) > width {
+		runes, suffix = runes[:max(width-3, 0)], "..."
+	}
+
+	var b strings.Builder
+	bold := false
+	for i, r := range runes {
+		on := len(highlight) > 0 && highlight[0] == i
+		if on {
+			highlight = highlight[1:]
+		}
+		if on && !bold {
+			b.WriteString(ansiBold)
+		} else if !on && bold {
+			b.WriteString(ansiReset)
+		}
+		bold = on
+		switch r {
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if bold {
+		b.WriteString(ansiReset)
+	}
+	return b.String() + suffix
+}
+
+// printFiles lists a file clip's entries under its summary line
+func printFiles(files []socket.FileData) {
+	for _, f := range files {
+		switch {
+		case !f.Exists:
+			fmt.Printf("                     %s (missing)\n", f.Path)
+		case f.Size > 0:
+			fmt.Printf("                     %s (%s)\n", f.Path, formatSize(f.Size))
+		default:
+			fmt.Printf("                     %s\n", f.Path)
+		}
+	}
+}
+
+// formatSize renders a byte count as B, KB, MB or GB
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, suffix := float64(n)/unit, "KB"
+	for _, s := range []string{"MB", "GB"} {
+		if size < unit {
+			break
+		}
+		size, suffix = size/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", size, suffix)
+}
+
+// reportMissing warns about the requested IDs the daemon did not remove
+func reportMissing(requested, removed []int64) {
+	done := make(map[int64]bool, len(removed))
+	for _, id := range removed {
+		done[id] = true
+	}
+	for _, id := range requested {
+		if !done[id] {
+			fmt.Fprintf(os.Stderr, "clip %d not found\n", id)
+		}
+	}
+}
+
+// pluralClips formats a clip count, e.g. "1 clip" or "3 clips"
+func pluralClips(n int) string {
+	if n == 1 {
+		return "1 clip"
+	}
+	return fmt.Sprintf("%d clips", n)
+}
+
+// printStats shows history usage against its limits
+func printStats(stats socket.StatsData) {
+	fmt.Printf("Clips:  %d of %d (%d pinned)\n", stats.Clips, stats.MaxClips, stats.Pinned)
+	if stats.MaxBytes > 0 {
+		fmt.Printf("Size:   %s of %s (%.0f%%)\n", formatSize(stats.Bytes), formatSize(stats.MaxBytes),
+			float64(stats.Bytes)/float64(stats.MaxBytes)*100)
+	} else {
+		fmt.Printf("Size:   %s (no limit)\n", formatSize(stats.Bytes))
+	}
+	if stats.MaxClipSize > 0 {
+		fmt.Printf("Largest clip allowed: %s\n", formatSize(stats.MaxClipSize))
+	}
+}
+
+// printCaptureStatus says whether clips are being recorded
+func printCaptureStatus(status socket.CaptureStatusData) {
+	switch {
+	case !status.Paused:
+		fmt.Println("Recording clips")
+	case status.Until > 0:
+		fmt.Printf("Paused until %s\n", time.Unix(status.Until, 0).Format("15:04:05"))
+	default:
+		fmt.Println("Paused until `clipnest resume`")
+	}
+}
+
+// printVerdict shows which rules matched and what would be stored
+func printVerdict(v socket.RulesTestData) {
+	if len(v.Matched) == 0 {
+		fmt.Println("No rules matched; the clip would be stored as is")
+		return
+	}
+	fmt.Printf("Matched: %s\n", strings.Join(v.Matched, ", "))
+	switch {
+	case v.Drop:
+		fmt.Println("The clip would be dropped")
+		return
+	case v.Redacted:
+		fmt.Printf("The clip would be stored redacted:\n%s\n", v.Text)
+	default:
+		fmt.Println("The clip would be stored")
+	}
+	if v.TTLSeconds > 0 {
+		fmt.Printf("It would expire after %s\n", time.Duration(v.TTLSeconds)*time.Second)
+	}
+	if v.Sensitive {
+		fmt.Println("It would be marked sensitive")
+	}
+}
+
+// request sends msg and decodes a successful response's data into out, exiting on any error
+func request(client *socket.Client, msg socket.SocketMessage, out interface{}) {
+	if err := client.Send(msg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	resp, err := client.Receive()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	rawData, err := json.Marshal(resp.Data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var respMsg struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+		Error   string          `json:"error"`
+	}
+	if err := json.Unmarshal(rawData, &respMsg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !respMsg.Success {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", respMsg.Error)
+		os.Exit(1)
+	}
+
+	if out != nil && len(respMsg.Data) > 0 {
+		if err := json.Unmarshal(respMsg.Data, out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+			os.Exit(1)
 		}
-		fmt.Printf("[%s] %-4d %s  %s\n", pin, clip.ID, ts, content)
 	}
 }
 
@@ -218,13 +788,30 @@ func printUsage() {
 	fmt.Fprintf(os.Stderr, `Usage: clipnest <command> [args]
 
 Commands:
-  list [limit]     List recent clips (default: 20)
-  search <query>   Search clips by content
-  copy <id>        Copy clip back to system clipboard
-  pin <id>         Pin a clip (protect from eviction)
-  unpin <id>       Unpin a clip
-  pins             List pinned clips only
-  clear            Clear all clips
-  version          Show version
+  list [limit] [--sort <order>]    List recent clips (default: 20); order: recent, frecency (most used) or pinned-first
+  list --tag <tag> [limit]         List only the clips with a tag
+  search [--sort <order>] <query>  Fuzzy-search clips, best matches first unless sorted as for list
+  copy [--primary] <id>            Copy clip back to system clipboard (or PRIMARY)
+  keep                             Cancel clearing a copied sensitive clip from the clipboard
+  sensitive <id> [on|off]          Mark a clip sensitive: copying it clears the clipboard later
+  expire <id> <duration>|never     Remove a clip after duration (e.g. 2h, 7d), even if pinned
+  pin <id>                         Pin a clip (protect from eviction)
+  unpin <id>                       Unpin a clip
+  pins                             List pinned clips only
+  tag <id> <tag>[,<tag>...]        Tag a clip, e.g. tag 42 work,sql (search with tag:work)
+  untag <id> [<tag>...]            Remove tags from a clip, or all of them
+  tags                             List tags in use with how many clips carry each
+  image <id> [file]                Save an image clip as PNG (stdout if no file)
+  show <id> [--mime <type>]        Print a clip's full content, or one of its other formats
+  rm <id>... | rm --query <query>  Delete clips by id, or every clip search finds (pins too)
+  clear [--keep-pins]              Clear all clips, or only the unpinned ones
+  trash                            List deleted and evicted clips, most recently removed first
+  restore <id>                     Bring a clip back from the trash, with its id and pin
+  undo                             Bring back the clips of the last rm or clear
+  stats                            Show how many clips and bytes the history holds
+  pause [duration]                 Stop recording clips, for a while if given (e.g. 10m)
+  resume                           Record clips again
+  rules test <text>|-              Show what the ignore rules would do with text (- reads stdin)
+  version                          Show version
 `)
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTakeFlags(t *testing.T) {
+	tests := []struct {
+		args   []string
+		values map[string]string
+		rest   []string
+	}{
+		{nil, map[string]string{}, nil},
+		{[]string{"10"}, map[string]string{}, []string{"10"}},
+		{[]string{"--sort", "frecency", "10"}, map[string]string{"--sort": "frecency"}, []string{"10"}},
+		{[]string{"10", "--sort", "frecency", "--tag", "work"}, map[string]string{"--sort": "frecency", "--tag": "work"}, []string{"10"}},
+		{[]string{"--tag", "work", "--sort", "frecency", "10"}, map[string]string{"--sort": "frecency", "--tag": "work"}, []string{"10"}},
+		{[]string{"--tag=work", "10", "--sort=recent"}, map[string]string{"--sort": "recent", "--tag": "work"}, []string{"10"}},
+		{[]string{"git", "--sort", "recent", "-github", "push"}, map[string]string{"--sort": "recent"}, []string{"git", "-github", "push"}},
+		{[]string{"--sort", "recent", "--", "--tag", "x"}, map[string]string{"--sort": "recent"}, []string{"--tag", "x"}},
+	}
+	for _, tt := range tests {
+		values, rest, err := takeFlags(tt.args, "--sort", "--tag")
+		if err != nil {
+			t.Errorf("takeFlags(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, tt.values) || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("takeFlags(%q) = %v, %q, want %v, %q", tt.args, values, rest, tt.values, tt.rest)
+		}
+	}
+}
+
+func TestTakeFlags_Errors(t *testing.T) {
+	for _, args := range [][]string{
+		{"10", "--limit", "5"},
+		{"--sort", "recent", "--verbose"},
+		{"10", "--tag"},
+	} {
+		if _, _, err := takeFlags(args, "--sort", "--tag"); err == nil {
+			t.Errorf("takeFlags(%q) succeeded, want an error", args)
+		}
+	}
+}
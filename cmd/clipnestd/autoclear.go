@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"clipnest/internal/clipboard"
+	"clipnest/internal/storage"
+)
+
+// autoClear wipes sensitive clips off the clipboard some time after they
+// were copied back, per selection
+type autoClear struct {
+	mu      sync.Mutex
+	after   time.Duration // 0 disables clearing
+	restore bool          // put back the previous content instead of clearing
+	pending map[string]*pendingClear
+	gen     int // bumped for every scheduled clear, so a stale timer does nothing
+}
+
+// pendingClear is a scheduled clear of one selection
+type pendingClear struct {
+	gen      int
+	timer    *time.Timer
+	at       time.Time
+	clip     storage.Clip
+	previous map[string][]byte // what to restore; nil clears the selection
+}
+
+// configure applies the sensitive_clear_after and sensitive_restore settings
+// to clears scheduled from now on
+func (a *autoClear) configure(after time.Duration, restore bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.after = after
+	a.restore = restore
+}
+
+// copyClip writes clip to selection without recording it as a new capture.
+// A sensitive clip is cleared again after the configured delay; the returned
+// time is when (zero if never).
+func (d *daemon) copyClip(selection string, clip storage.Clip) (time.Time, error) {
+	a := d.clears
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Whatever was waiting to be cleared is replaced by this copy, but what
+	// it would have restored is still the content to go back to
+	old := a.pending[selection]
+	if old != nil {
+		old.timer.Stop()
+		delete(a.pending, selection)
+	}
+
+	var previous map[string][]byte
+	schedule := clip.Sensitive && a.after > 0
+	if schedule && a.restore {
+		if old != nil {
+			previous = old.previous
+		} else if content, ok := clipboard.Snapshot(d.backends[selection]); ok {
+			previous = content.MIMEData()
+		}
+	}
+
+	if err := d.write(selection, clipFormats(clip)); err != nil {
+		return time.Time{}, err
+	}
+	if !schedule {
+		return time.Time{}, nil
+	}
+
+	a.gen++
+	gen := a.gen
+	p := &pendingClear{gen: gen, at: time.Now().Add(a.after), clip: clip, previous: previous}
+	p.timer = time.AfterFunc(a.after, func() { d.runClear(selection, gen) })
+	a.pending[selection] = p
+	return p.at, nil
+}
+
+// stop cancels every scheduled clear for good
+func (a *autoClear) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for selection, p := range a.pending {
+		p.timer.Stop()
+		delete(a.pending, selection)
+	}
+	a.after = 0
+}
+
+// cancelClears drops every scheduled clear and returns how many there were
+func (d *daemon) cancelClears() int {
+	a := d.clears
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := len(a.pending)
+	for selection, p := range a.pending {
+		p.timer.Stop()
+		delete(a.pending, selection)
+	}
+	return n
+}
+
+// runClear clears selection for the scheduled clear gen, but only if the
+// clipboard still holds the sensitive clip
+func (d *daemon) runClear(selection string, gen int) {
+	a := d.clears
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p := a.pending[selection]
+	if p == nil || p.gen != gen {
+		return
+	}
+	delete(a.pending, selection)
+
+	current, _ := clipboard.Snapshot(d.backends[selection])
+	if !current.Equal(clipboard.ContentOf(clipFormats(p.clip))) {
+		return // something else was copied since
+	}
+	formats := p.previous
+	if formats == nil {
+		formats = map[string][]byte{clipboard.MIMEText: nil}
+	}
+	if err := d.write(selection, formats); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to clear sensitive clip %d: %v\n", p.clip.ID, err)
+	}
+}
+
+// write puts formats on selection; a monitored selection doesn't record the write as a new clip
+func (d *daemon) write(selection string, formats map[string][]byte) error {
+	if monitor, ok := d.monitors[selection]; ok {
+		return monitor.Write(formats)
+	}
+	return d.backends[selection].WriteFormats(formats)
+}
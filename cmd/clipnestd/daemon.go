@@ -0,0 +1,802 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"clipnest/internal/clipboard"
+	"clipnest/internal/config"
+	"clipnest/internal/socket"
+	"clipnest/internal/storage"
+)
+
+// daemon ties storage, the clipboard monitors and the socket server together
+type daemon struct {
+	cfg      config.Config
+	store    *storage.Storage
+	rules    *ruleSet
+	backends map[string]clipboard.Backend // by selection; used to restore clips
+	monitors map[string]*clipboard.Monitor
+	syncer   *selectionSync
+	clears   *autoClear
+	server   *socket.Server
+	done     chan struct{} // closed to stop the expiry sweeper
+	maxAge   atomic.Int64  // retention of unpinned clips (a time.Duration); 0 keeps them
+
+	pauseMu     sync.Mutex
+	paused      bool
+	pausedUntil time.Time   // zero when paused until resumed
+	resumeTimer *time.Timer // auto-resume of a timed pause
+	pauseGen    int         // bumped by every pause, so a stale timer does nothing
+}
+
+// sweepInterval is how often clips past their expiry are removed
+const sweepInterval = 15 * time.Second
+
+// newDaemon serves cfg.SocketPath and records every selection that has a
+// watcher, reading it through its backend
+func newDaemon(cfg config.Config, store *storage.Storage, backends map[string]clipboard.Backend, watchers map[string]clipboard.Watcher) (*daemon, error) {
+	d := &daemon{
+		cfg:      cfg,
+		store:    store,
+		rules:    &ruleSet{},
+		backends: backends,
+		monitors: make(map[string]*clipboard.Monitor),
+		done:     make(chan struct{}),
+	}
+	if err := d.rules.load(cfg); err != nil {
+		return nil, fmt.Errorf("failed to load rules: %w", err)
+	}
+	if err := applySizeLimits(store, cfg); err != nil {
+		return nil, fmt.Errorf("failed to apply size limits: %w", err)
+	}
+	store.SetTrashSize(cfg.TrashSize)
+	if err := store.SetDedupMode(storage.DedupMode(cfg.Dedup)); err != nil {
+		return nil, fmt.Errorf("failed to apply dedup mode: %w", err)
+	}
+	if err := store.SetProtectTagged(cfg.ProtectTagged); err != nil {
+		return nil, fmt.Errorf("failed to apply protect_tagged: %w", err)
+	}
+	d.maxAge.Store(int64(cfg.MaxAge))
+	d.syncer = &selectionSync{backends: backends, monitors: d.monitors}
+	d.clears = &autoClear{pending: make(map[string]*pendingClear)}
+	d.clears.configure(time.Duration(cfg.SensitiveClearAfter), cfg.SensitiveRestore)
+
+	server, err := socket.NewServer(cfg.SocketPath, d.handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start socket server: %w", err)
+	}
+	d.server = server
+
+	// Clipboard monitors: detect changes and store them
+	for selection, watcher := range watchers {
+		monitor := clipboard.NewMonitor(backends[selection], time.Duration(cfg.PollInterval), d.capture(selection))
+		monitor.SetWatcher(watcher)
+		d.monitors[selection] = monitor
+	}
+	for _, monitor := range d.monitors {
+		monitor.Start()
+	}
+	go d.sweep()
+	return d, nil
+}
+
+// close stops the monitors, the sweeper and the socket server
+func (d *daemon) close() {
+	for _, monitor := range d.monitors {
+		monitor.Stop()
+	}
+	close(d.done)
+	d.clears.stop()
+	d.pauseMu.Lock()
+	if d.resumeTimer != nil {
+		d.resumeTimer.Stop()
+		d.resumeTimer = nil
+	}
+	d.pauseMu.Unlock()
+	d.server.Close()
+}
+
+// applySizeLimits configures the store's byte budget from cfg
+func applySizeLimits(store *storage.Storage, cfg config.Config) error {
+	return store.SetSizeLimits(int64(cfg.MaxTotalSize), int64(cfg.MaxClipSize), cfg.OversizePolicy == config.OversizeTruncate)
+}
+
+// sweep removes expired clips now and every sweepInterval until the daemon closes
+func (d *daemon) sweep() {
+	d.sweepExpired(time.Now())
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			d.sweepExpired(now)
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// sweepExpired removes the clips that expired by now and tells clients
+func (d *daemon) sweepExpired(now time.Time) {
+	removed, err := d.store.RemoveExpired(now, time.Duration(d.maxAge.Load()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to remove expired clips: %v\n", err)
+	}
+	d.broadcastRemoved(removed, "expired")
+}
+
+// broadcastRestored announces clips back from the trash as new clips, oldest
+// first so clients that prepend them end up in history order
+func (d *daemon) broadcastRestored(clips []storage.Clip) {
+	for i := len(clips) - 1; i >= 0; i-- {
+		_ = d.server.Broadcast(socket.SocketMessage{
+			Type: "new_clip",
+			Data: clipToData(clips[i]),
+		})
+	}
+}
+
+// listTagged returns the clips filed under tag, up to limit, in order
+func (d *daemon) listTagged(tag string, limit int, order storage.SortOrder) ([]storage.Clip, error) {
+	name, err := storage.NormalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := d.store.SearchSorted("tag:"+name, limit, order)
+	if err != nil {
+		return nil, err
+	}
+	clips := make([]storage.Clip, len(matches))
+	for i, m := range matches {
+		clips[i] = m.Clip
+	}
+	return clips, nil
+}
+
+// broadcastRemoved tells clients which clips went away and why
+func (d *daemon) broadcastRemoved(ids []int64, reason string) {
+	if len(ids) == 0 {
+		return
+	}
+	_ = d.server.Broadcast(socket.SocketMessage{
+		Type: "clip_removed",
+		Data: socket.ClipRemovedData{IDs: ids, Reason: reason},
+	})
+}
+
+// handle dispatches incoming commands from CLI clients
+func (d *daemon) handle(conn net.Conn, msg socket.SocketMessage) {
+	switch msg.Type {
+	case "list":
+		limit := 20
+		if msg.Data != nil {
+			if m, ok := msg.Data.(map[string]interface{}); ok {
+				if l, ok := m["limit"].(float64); ok && l > 0 {
+					limit = int(l)
+				}
+			}
+		}
+		order, err := sortOrder(msg, storage.SortRecent)
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		m, _ := msg.Data.(map[string]interface{})
+		if tag, _ := m["tag"].(string); tag != "" {
+			clips, err := d.listTagged(tag, limit, order)
+			if err != nil {
+				sendError(conn, err.Error())
+				return
+			}
+			sendClipList(conn, clips)
+			return
+		}
+		clips, _ := d.store.ListSorted(limit, order)
+		sendClipList(conn, clips)
+
+	case "search":
+		query := ""
+		limit := 20
+		if m, ok := msg.Data.(map[string]interface{}); ok {
+			if q, ok := m["query"].(string); ok {
+				query = q
+			}
+			if l, ok := m["limit"].(float64); ok && l > 0 {
+				limit = int(l)
+			}
+		}
+		order, err := sortOrder(msg, storage.SortRelevance)
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		matches, err := d.store.SearchSorted(query, limit, order)
+		var qerr *storage.QueryError
+		if errors.As(err, &qerr) {
+			sendErrorData(conn, err.Error(), socket.QueryErrorData{Pos: qerr.Pos, Token: qerr.Token, Message: qerr.Message})
+			return
+		}
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		clips := make([]socket.ClipData, len(matches))
+		for i, m := range matches {
+			clips[i] = clipToData(m.Clip)
+			clips[i].MatchPositions = m.Positions
+		}
+		sendData(conn, socket.ClipListData{Clips: clips, Count: len(clips)})
+
+	case "pins":
+		clips, _ := d.store.GetPinned()
+		sendClipList(conn, clips)
+
+	case "copy_clip":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		clip, err := d.store.Get(id)
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		selection := clipboard.SelectionClipboard
+		if m, ok := msg.Data.(map[string]interface{}); ok {
+			if primary, _ := m["primary"].(bool); primary {
+				selection = clipboard.SelectionPrimary
+			}
+		}
+		if _, ok := d.backends[selection]; !ok {
+			sendError(conn, fmt.Sprintf("the %s selection is not supported on this system", selection))
+			return
+		}
+		clearAt, err := d.copyClip(selection, clip)
+		if err != nil {
+			sendError(conn, fmt.Sprintf("failed to copy: %v", err))
+			return
+		}
+		copied, err := d.store.RecordCopy(clip.ID, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to record copy of clip %d: %v\n", clip.ID, err)
+			copied = clip
+		}
+		sendData(conn, socket.CopyClipData{ID: clip.ID, ClearAt: unixOrZero(clearAt)})
+
+		// The copy is now the most recent clip
+		_ = d.server.Broadcast(socket.SocketMessage{Type: "new_clip", Data: clipToData(copied)})
+		if d.cfg.SelectionSync && len(d.monitors) > 1 {
+			d.syncer.mirror(copied, selection)
+		}
+
+	case "expire":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		m, _ := msg.Data.(map[string]interface{})
+		ttl, ok := m["ttl_ms"].(float64)
+		if !ok || ttl < 0 {
+			sendError(conn, "missing or negative ttl_ms")
+			return
+		}
+		var at time.Time
+		if ttl > 0 {
+			at = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+		if err := d.store.SetExpiry(id, at); err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendOK(conn)
+
+	case "cancel_clear":
+		sendData(conn, socket.CancelClearData{Canceled: d.cancelClears()})
+
+	case "set_sensitive":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		sensitive := true
+		if m, ok := msg.Data.(map[string]interface{}); ok {
+			if v, ok := m["sensitive"].(bool); ok {
+				sensitive = v
+			}
+		}
+		if err := d.store.SetSensitive(id, sensitive); err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendOK(conn)
+
+	case "get_image":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		clip, err := d.store.Get(id)
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		if clip.Type != "image" {
+			sendError(conn, fmt.Sprintf("clip %d is not an image", id))
+			return
+		}
+		sendData(conn, socket.ImageData{
+			ID:     clip.ID,
+			Width:  clip.Width,
+			Height: clip.Height,
+			Data:   clip.Data,
+		})
+
+	case "get_format":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		mime := clipboard.MIMEText
+		if m, ok := msg.Data.(map[string]interface{}); ok {
+			if v, ok := m["mime"].(string); ok && v != "" {
+				mime = v
+			}
+		}
+		clip, err := d.store.Get(id)
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		data, ok := clipFormat(clip, mime)
+		if !ok {
+			sendError(conn, fmt.Sprintf("clip %d has no %s representation", id, mime))
+			return
+		}
+		sendData(conn, socket.FormatData{ID: clip.ID, MIME: mime, Data: data})
+
+	case "pin":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		if err := d.store.Pin(id); err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendOK(conn)
+
+	case "unpin":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		if err := d.store.Unpin(id); err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendOK(conn)
+
+	case "delete":
+		m, _ := msg.Data.(map[string]interface{})
+		ids := extractIDs(msg)
+		query, _ := m["query"].(string)
+		var removed []int64
+		var err error
+		switch {
+		case len(ids) > 0 && query != "":
+			sendError(conn, "give either ids or a query, not both")
+			return
+		case len(ids) > 0:
+			removed, err = d.store.RemoveIDs(ids)
+		case query != "":
+			removed, err = d.store.RemoveMatching(query)
+		default:
+			sendError(conn, "missing clip ids or query")
+			return
+		}
+		var qerr *storage.QueryError
+		if errors.As(err, &qerr) {
+			sendErrorData(conn, err.Error(), socket.QueryErrorData{Pos: qerr.Pos, Token: qerr.Token, Message: qerr.Message})
+			return
+		}
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendData(conn, socket.ClipRemovedData{IDs: removed, Reason: "deleted"})
+		d.broadcastRemoved(removed, "deleted")
+
+	case "clear":
+		keepPinned := false
+		if m, ok := msg.Data.(map[string]interface{}); ok {
+			keepPinned, _ = m["keep_pinned"].(bool)
+		}
+		removed, err := d.store.Clear(keepPinned)
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendData(conn, socket.ClipRemovedData{IDs: removed, Reason: "cleared"})
+		d.broadcastRemoved(removed, "cleared")
+
+	case "trash":
+		trash := d.store.Trash()
+		clips := make([]socket.TrashedClipData, len(trash))
+		for i, entry := range trash {
+			clips[i] = socket.TrashedClipData{
+				ClipData:  clipToData(entry.Clip),
+				Reason:    entry.Reason,
+				RemovedAt: entry.RemovedAt.Unix(),
+			}
+		}
+		sendData(conn, socket.TrashListData{Clips: clips, Count: len(clips)})
+
+	case "tag", "untag":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		tags := extractTags(msg)
+		if msg.Type == "tag" && len(tags) == 0 {
+			sendError(conn, "missing tags")
+			return
+		}
+		var clip storage.Clip
+		var err error
+		if msg.Type == "tag" {
+			clip, err = d.store.Tag(id, tags)
+		} else {
+			clip, err = d.store.Untag(id, tags)
+		}
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendData(conn, clipToData(clip))
+
+	case "tags":
+		tags, err := d.store.Tags()
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		data := socket.TagListData{Tags: make([]socket.TagData, len(tags)), Count: len(tags)}
+		for i, tag := range tags {
+			data.Tags[i] = socket.TagData{Name: tag.Name, Count: tag.Count}
+		}
+		sendData(conn, data)
+
+	case "restore":
+		id := extractID(msg)
+		if id == 0 {
+			sendError(conn, "missing clip id")
+			return
+		}
+		clip, err := d.store.Restore(id)
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendData(conn, clipToData(clip))
+		d.broadcastRestored([]storage.Clip{clip})
+
+	case "undo":
+		clips, err := d.store.Undo()
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendClipList(conn, clips)
+		d.broadcastRestored(clips)
+
+	case "pause":
+		var duration time.Duration
+		if m, ok := msg.Data.(map[string]interface{}); ok {
+			if ms, ok := m["duration_ms"].(float64); ok {
+				if ms < 0 {
+					sendError(conn, "pause duration must not be negative")
+					return
+				}
+				duration = time.Duration(ms) * time.Millisecond
+			}
+		}
+		sendData(conn, d.pause(duration))
+
+	case "resume":
+		sendData(conn, d.resume())
+
+	case "capture_status":
+		sendData(conn, d.captureStatus())
+
+	case "stats":
+		stats, err := d.store.Stats()
+		if err != nil {
+			sendError(conn, err.Error())
+			return
+		}
+		sendData(conn, socket.StatsData{
+			Clips:       stats.Clips,
+			Pinned:      stats.Pinned,
+			Bytes:       stats.Bytes,
+			MaxClips:    stats.MaxClips,
+			MaxBytes:    stats.MaxBytes,
+			MaxClipSize: stats.MaxClipSize,
+		})
+
+	case "test_rules":
+		text := ""
+		if m, ok := msg.Data.(map[string]interface{}); ok {
+			text, _ = m["text"].(string)
+		}
+		v := d.rules.evaluate(text)
+		sendData(conn, socket.RulesTestData{
+			Drop:       v.Drop,
+			Redacted:   v.Redacted,
+			Text:       v.Text,
+			TTLSeconds: int64(v.TTL / time.Second),
+			Sensitive:  v.Sensitive,
+			Matched:    v.Matched,
+		})
+
+	default:
+		sendError(conn, fmt.Sprintf("unknown command: %s", msg.Type))
+	}
+}
+
+// pause stops recording every selection, resuming by itself after duration
+// unless it is 0; pausing again replaces the previous duration
+func (d *daemon) pause(duration time.Duration) socket.CaptureStatusData {
+	d.pauseMu.Lock()
+	if d.resumeTimer != nil {
+		d.resumeTimer.Stop()
+		d.resumeTimer = nil
+	}
+	d.paused = true
+	d.pauseGen++
+	d.pausedUntil = time.Time{}
+	if duration > 0 {
+		d.pausedUntil = time.Now().Add(duration)
+		gen := d.pauseGen
+		d.resumeTimer = time.AfterFunc(duration, func() { d.resumeAfter(gen) })
+	}
+	for _, monitor := range d.monitors {
+		monitor.Pause()
+	}
+	status := d.statusLocked()
+	d.pauseMu.Unlock()
+
+	d.broadcastStatus(status)
+	return status
+}
+
+// resume records clips again; content copied while paused stays unrecorded
+func (d *daemon) resume() socket.CaptureStatusData {
+	d.pauseMu.Lock()
+	wasPaused := d.paused
+	d.resumeLocked()
+	status := d.statusLocked()
+	d.pauseMu.Unlock()
+
+	if wasPaused {
+		d.broadcastStatus(status)
+	}
+	return status
+}
+
+// resumeAfter ends the timed pause gen, unless a later pause or resume replaced it
+func (d *daemon) resumeAfter(gen int) {
+	d.pauseMu.Lock()
+	if !d.paused || d.pauseGen != gen {
+		d.pauseMu.Unlock()
+		return
+	}
+	d.resumeLocked()
+	status := d.statusLocked()
+	d.pauseMu.Unlock()
+
+	fmt.Println("Capture resumed")
+	d.broadcastStatus(status)
+}
+
+// resumeLocked resumes the monitors; pauseMu must be held
+func (d *daemon) resumeLocked() {
+	if d.resumeTimer != nil {
+		d.resumeTimer.Stop()
+		d.resumeTimer = nil
+	}
+	d.paused = false
+	d.pausedUntil = time.Time{}
+	for _, monitor := range d.monitors {
+		monitor.Resume()
+	}
+}
+
+// captureStatus reports whether recording is paused
+func (d *daemon) captureStatus() socket.CaptureStatusData {
+	d.pauseMu.Lock()
+	defer d.pauseMu.Unlock()
+	return d.statusLocked()
+}
+
+// statusLocked builds the capture status; pauseMu must be held
+func (d *daemon) statusLocked() socket.CaptureStatusData {
+	return socket.CaptureStatusData{Paused: d.paused, Until: unixOrZero(d.pausedUntil)}
+}
+
+// broadcastStatus tells clients (e.g. the menu bar app) whether recording is paused
+func (d *daemon) broadcastStatus(status socket.CaptureStatusData) {
+	_ = d.server.Broadcast(socket.SocketMessage{Type: "capture_status", Data: status})
+}
+
+// capture returns the monitor callback that stores changes seen on selection
+func (d *daemon) capture(selection string) func(clipboard.Content) {
+	return func(content clipboard.Content) {
+		clip := storage.Clip{
+			Content:   content.Text,
+			Type:      content.Type,
+			Timestamp: time.Now(),
+			Source:    selection,
+		}
+
+		if content.Type == "image" {
+			info, err := clipboard.InspectImage(content.Data, thumbnailSize)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping clipboard image: %v\n", err)
+				return
+			}
+			clip.Data = content.Data
+			clip.Width = info.Width
+			clip.Height = info.Height
+			clip.Hash = info.Hash
+			clip.Thumbnail = info.Thumbnail
+		} else {
+			v := d.rules.evaluate(content.Text)
+			switch {
+			case v.Drop:
+				return
+			case v.Redacted && content.Type == "files":
+				// A redacted path is useless to paste back
+				return
+			case v.Redacted:
+				// The other formats would still hold the secret
+				clip.Content = v.Text
+				content.Formats = nil
+			}
+			if v.TTL > 0 {
+				clip.ExpiresAt = clip.Timestamp.Add(v.TTL)
+			}
+			clip.Sensitive = v.Sensitive
+		}
+		clip.Formats = content.Formats
+		if content.Type == "files" {
+			clip.Files = statFiles(content.Files)
+		}
+
+		id, err := d.store.Add(clip)
+		if errors.Is(err, storage.ErrTooLarge) {
+			fmt.Fprintf(os.Stderr, "Skipping clip: %v\n", err)
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to store clip: %v\n", err)
+			return
+		}
+
+		// Broadcast to connected clients
+		stored, _ := d.store.Get(id)
+		_ = d.server.Broadcast(socket.SocketMessage{
+			Type: "new_clip",
+			Data: clipToData(stored),
+		})
+
+		// Redacted text, or a near duplicate's stored text, would overwrite
+		// the other selection's real content
+		if d.cfg.SelectionSync && len(d.monitors) > 1 && stored.Content == content.Text {
+			d.syncer.mirror(stored, selection)
+		}
+	}
+}
+
+// reload applies what can change live from a re-read config
+func (d *daemon) reload(newCfg config.Config) {
+	if err := d.rules.load(newCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Config reload failed, keeping current config: %v\n", err)
+		return
+	}
+	if err := d.store.SetMaxMemory(newCfg.MaxMemoryClips); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to apply max_memory_clips: %v\n", err)
+	}
+	if err := applySizeLimits(d.store, newCfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to apply size limits: %v\n", err)
+	}
+	d.cfg.MaxTotalSize = newCfg.MaxTotalSize
+	d.cfg.MaxClipSize = newCfg.MaxClipSize
+	d.cfg.OversizePolicy = newCfg.OversizePolicy
+	d.store.SetTrashSize(newCfg.TrashSize)
+	d.cfg.TrashSize = newCfg.TrashSize
+	if err := d.store.SetDedupMode(storage.DedupMode(newCfg.Dedup)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to apply dedup: %v\n", err)
+	}
+	d.cfg.Dedup = newCfg.Dedup
+	if err := d.store.SetProtectTagged(newCfg.ProtectTagged); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to apply protect_tagged: %v\n", err)
+	}
+	d.cfg.ProtectTagged = newCfg.ProtectTagged
+	for _, monitor := range d.monitors {
+		monitor.SetInterval(time.Duration(newCfg.PollInterval))
+	}
+
+	cfg := d.cfg
+	if newCfg.SocketPath != cfg.SocketPath || newCfg.DBPath != cfg.DBPath ||
+		newCfg.StorageBackend != cfg.StorageBackend || newCfg.HotClips != cfg.HotClips ||
+		newCfg.Watcher != cfg.Watcher || newCfg.PrimarySelection != cfg.PrimarySelection ||
+		newCfg.SelectionSync != cfg.SelectionSync {
+		fmt.Println("Note: socket_path, db_path, storage_backend, hot_clips, watcher, primary_selection " +
+			"and selection_sync take effect after restart")
+	}
+	d.cfg.MaxMemoryClips = newCfg.MaxMemoryClips
+	d.cfg.PollInterval = newCfg.PollInterval
+	d.cfg.IgnorePatterns = newCfg.IgnorePatterns
+	d.cfg.Rules = newCfg.Rules
+	d.cfg.MaxAge = newCfg.MaxAge
+	d.maxAge.Store(int64(newCfg.MaxAge))
+	d.clears.configure(time.Duration(newCfg.SensitiveClearAfter), newCfg.SensitiveRestore)
+
+	fmt.Printf("Config reloaded (max clips: %d, poll interval: %s, ignore patterns: %d, rules: %d)\n",
+		d.cfg.MaxMemoryClips, time.Duration(d.cfg.PollInterval), len(d.cfg.IgnorePatterns), len(d.cfg.Rules))
+	_ = d.server.Broadcast(socket.SocketMessage{
+		Type: "config_reloaded",
+		Data: socket.ConfigData{
+			MaxClips:       d.cfg.MaxMemoryClips,
+			PollIntervalMS: time.Duration(d.cfg.PollInterval).Milliseconds(),
+			IgnorePatterns: len(d.cfg.IgnorePatterns),
+			Rules:          len(d.cfg.Rules),
+		},
+	})
+}
+
+// selectionSync mirrors text clips between CLIPBOARD and PRIMARY, like klipper
+type selectionSync struct {
+	mu       sync.Mutex
+	last     string // text most recently mirrored, so its echo isn't mirrored back
+	backends map[string]clipboard.Backend
+	monitors map[string]*clipboard.Monitor
+}
+
+// mirror writes a text clip captured on from to the other selection
+func (s *selectionSync) mirror(clip storage.Clip, from string) {
+	if clip.Type != "text" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if clip.Content == s.last {
+		return
+	}
+	s.last = clip.Content
+
+	to := clipboard.SelectionPrimary
+	if from == to {
+		to = clipboard.SelectionClipboard
+	}
+	if err := s.backends[to].WriteFormats(clipFormats(clip)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to sync %s to %s: %v\n", from, to, err)
+		return
+	}
+	// Don't record our own write as a new change
+	s.monitors[to].SetLast(clipboard.Content{Type: "text", Text: clip.Content})
+}
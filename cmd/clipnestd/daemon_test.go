@@ -0,0 +1,711 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"clipnest/internal/clipboard"
+	"clipnest/internal/config"
+	"clipnest/internal/rules"
+	"clipnest/internal/socket"
+	"clipnest/internal/storage"
+)
+
+// TestConfigAgrees checks that the names and defaults config has are the ones
+// of the packages they configure, as config doesn't import them
+func TestConfigAgrees(t *testing.T) {
+	names := [][2]string{
+		{config.WatcherAuto, clipboard.WatcherAuto},
+		{config.WatcherPoll, clipboard.WatcherPoll},
+		{config.WatcherWayland, clipboard.WatcherWayland},
+		{config.WatcherX11, clipboard.WatcherX11},
+		{config.DedupExact, string(storage.DedupExact)},
+		{config.DedupWhitespace, string(storage.DedupWhitespace)},
+		{config.DedupCaseInsensitive, string(storage.DedupCaseInsensitive)},
+		{config.DedupConsecutive, string(storage.DedupConsecutive)},
+	}
+	for _, name := range names {
+		if name[0] != name[1] {
+			t.Errorf("config name %q, want %q", name[0], name[1])
+		}
+	}
+
+	if config.DefaultTrashSize != storage.DefaultTrashSize {
+		t.Errorf("config trash size default %d, want %d", config.DefaultTrashSize, storage.DefaultTrashSize)
+	}
+}
+
+// startDaemon runs a daemon over memory storage and a fake clipboard and
+// connects a client to it
+func startDaemon(t *testing.T, cfg config.Config) (*clipboard.FakeBackend, *socket.Client, *daemon) {
+	t.Helper()
+	cfg.SocketPath = filepath.Join(t.TempDir(), "clipnest.sock")
+
+	store, err := storage.NewStorage(cfg.MaxMemoryClips)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	fake := clipboard.NewFakeBackend()
+	d, err := newDaemon(cfg, store,
+		map[string]clipboard.Backend{clipboard.SelectionClipboard: fake},
+		map[string]clipboard.Watcher{clipboard.SelectionClipboard: fake.Watcher()})
+	if err != nil {
+		t.Fatalf("Failed to start daemon: %v", err)
+	}
+	t.Cleanup(d.close)
+
+	client, err := socket.NewClient(cfg.SocketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	// A round trip guarantees the server registered us for broadcasts
+	listClips(t, client)
+	return fake, client, d
+}
+
+// waitFor reads messages until one of type typ arrives and decodes its data into out
+func waitFor(t *testing.T, client *socket.Client, typ string, out interface{}) {
+	t.Helper()
+	for {
+		msg, err := client.Receive()
+		if err != nil {
+			t.Fatalf("Waiting for %s: %v", typ, err)
+		}
+		if msg.Type != typ {
+			continue
+		}
+		if out != nil {
+			decode(t, msg.Data, out)
+		}
+		return
+	}
+}
+
+// waitSeen waits until the daemon has read the fake clipboard since it last
+// changed, for changes that are dropped without a trace
+func waitSeen(t *testing.T, fake *clipboard.FakeBackend) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !fake.Seen() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the clipboard to be read")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// request sends msg and decodes the response data into out, failing on an error response
+func request(t *testing.T, client *socket.Client, msg socket.SocketMessage, out interface{}) {
+	t.Helper()
+	if err := requestErr(t, client, msg, out); err != "" {
+		t.Fatalf("%s failed: %s", msg.Type, err)
+	}
+}
+
+// requestErr sends msg and returns the error of the response ("" on success)
+func requestErr(t *testing.T, client *socket.Client, msg socket.SocketMessage, out interface{}) string {
+	t.Helper()
+	if err := client.Send(msg); err != nil {
+		t.Fatalf("Failed to send %s: %v", msg.Type, err)
+	}
+	var resp struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+		Error   string          `json:"error"`
+	}
+	waitFor(t, client, "response", &resp)
+	if !resp.Success {
+		return resp.Error
+	}
+	if out != nil {
+		decode(t, resp.Data, out)
+	}
+	return ""
+}
+
+// decode round-trips data through JSON into out
+func decode(t *testing.T, data interface{}, out interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		t.Fatalf("Failed to decode %s: %v", raw, err)
+	}
+}
+
+// listClips returns the daemon's clip list
+func listClips(t *testing.T, client *socket.Client) []socket.ClipData {
+	t.Helper()
+	var list socket.ClipListData
+	request(t, client, socket.SocketMessage{Type: "list", Data: map[string]interface{}{"limit": 100}}, &list)
+	return list.Clips
+}
+
+func TestDaemon_CapturesClipboardChanges(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	fake.SetText("hello")
+	var clip socket.ClipData
+	waitFor(t, client, "new_clip", &clip)
+	if clip.Content != "hello" || clip.Type != "text" || clip.Source != clipboard.SelectionClipboard {
+		t.Fatalf("Unexpected clip: %+v", clip)
+	}
+
+	clips := listClips(t, client)
+	if len(clips) != 1 || clips[0].ID != clip.ID {
+		t.Fatalf("Expected the captured clip in the list, got %+v", clips)
+	}
+}
+
+func TestDaemon_CopyClip(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	fake.SetText("first")
+	var first socket.ClipData
+	waitFor(t, client, "new_clip", &first)
+	fake.SetText("second")
+	waitFor(t, client, "new_clip", nil)
+
+	request(t, client, socket.SocketMessage{Type: "copy_clip", Data: map[string]interface{}{"id": first.ID}}, nil)
+	if got := string(fake.Formats()[clipboard.MIMEText]); got != "first" {
+		t.Fatalf("Expected clipboard to hold %q, got %q", "first", got)
+	}
+
+	// The copy moves the clip to the front and counts as a use, not a capture
+	var copied socket.ClipData
+	waitFor(t, client, "new_clip", &copied)
+	if copied.ID != first.ID || copied.Copies != 1 || copied.LastUsed == 0 || copied.Captures != 1 {
+		t.Fatalf("Expected copy to move clip %d to the front as used once, got %+v", first.ID, copied)
+	}
+	if clips := listClips(t, client); len(clips) != 2 || clips[0].ID != first.ID {
+		t.Fatalf("Expected 2 clips with the copied one first, got %+v", clips)
+	}
+
+	if err := requestErr(t, client, socket.SocketMessage{Type: "copy_clip", Data: map[string]interface{}{"id": 99}}, nil); err == "" {
+		t.Fatal("Expected error copying a missing clip")
+	}
+	if err := requestErr(t, client, socket.SocketMessage{Type: "copy_clip", Data: map[string]interface{}{"id": first.ID, "primary": true}}, nil); err == "" {
+		t.Fatal("Expected error copying to a selection without a backend")
+	}
+}
+
+func TestDaemon_RichFormats(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	fake.Set(map[string][]byte{
+		clipboard.MIMEText: []byte("bold"),
+		clipboard.MIMEHTML: []byte("<b>bold</b>"),
+	})
+	var clip socket.ClipData
+	waitFor(t, client, "new_clip", &clip)
+	if len(clip.Formats) != 1 || clip.Formats[0] != clipboard.MIMEHTML {
+		t.Fatalf("Expected text/html format, got %v", clip.Formats)
+	}
+
+	var format socket.FormatData
+	request(t, client, socket.SocketMessage{
+		Type: "get_format",
+		Data: map[string]interface{}{"id": clip.ID, "mime": clipboard.MIMEHTML},
+	}, &format)
+	if string(format.Data) != "<b>bold</b>" {
+		t.Fatalf("Unexpected HTML %q", format.Data)
+	}
+
+	// Copying restores every flavor
+	fake.SetText("plain")
+	waitFor(t, client, "new_clip", nil)
+	request(t, client, socket.SocketMessage{Type: "copy_clip", Data: map[string]interface{}{"id": clip.ID}}, nil)
+	formats := fake.Formats()
+	if string(formats[clipboard.MIMEText]) != "bold" || string(formats[clipboard.MIMEHTML]) != "<b>bold</b>" {
+		t.Fatalf("Expected text and HTML to be restored, got %q", formats)
+	}
+}
+
+func TestDaemon_FileClips(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("12345"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "gone.txt")
+
+	fake.Set(clipboard.FileFormats([]string{path, missing}))
+	var clip socket.ClipData
+	waitFor(t, client, "new_clip", &clip)
+	if clip.Type != "files" || len(clip.Files) != 2 {
+		t.Fatalf("Expected a files clip with 2 entries, got %+v", clip)
+	}
+	if !clip.Files[0].Exists || clip.Files[0].Size != 5 || clip.Files[1].Exists {
+		t.Fatalf("Unexpected file details: %+v", clip.Files)
+	}
+
+	fake.SetText("other")
+	waitFor(t, client, "new_clip", nil)
+	request(t, client, socket.SocketMessage{Type: "copy_clip", Data: map[string]interface{}{"id": clip.ID}}, nil)
+	paths, ok := clipboard.ParseURIList(fake.Formats()[clipboard.MIMEURIList])
+	if !ok || len(paths) != 2 || paths[0] != path {
+		t.Fatalf("Expected the uri-list to be restored, got %v", paths)
+	}
+}
+
+func TestDaemon_IgnorePatterns(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.IgnorePatterns = []string{"^secret"}
+	fake, client, _ := startDaemon(t, cfg)
+
+	// The secret must be read before it is replaced, or nothing is tested
+	fake.SetText("secret-token")
+	waitSeen(t, fake)
+	fake.SetText("public")
+	var clip socket.ClipData
+	waitFor(t, client, "new_clip", &clip)
+	if clip.Content != "public" {
+		t.Fatalf("Expected only the public clip, got %+v", clip)
+	}
+	clips := listClips(t, client)
+	if len(clips) != 1 || clips[0].Content != "public" {
+		t.Fatalf("Expected ignored clip not to be stored, got %+v", clips)
+	}
+}
+
+func TestDaemon_Rules(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Rules = []config.Rule{
+		{Name: "cards", Detector: config.DetectorCreditCard, Action: config.ActionRedact},
+		{Name: "otp", Pattern: `^\d{6}$`, Action: config.ActionExpire, TTL: config.Duration(time.Minute)},
+	}
+	fake, client, d := startDaemon(t, cfg)
+
+	fake.Set(map[string][]byte{
+		clipboard.MIMEText: []byte("card 4111 1111 1111 1111"),
+		clipboard.MIMEHTML: []byte("<b>4111 1111 1111 1111</b>"),
+	})
+	var redacted socket.ClipData
+	waitFor(t, client, "new_clip", &redacted)
+	if redacted.Content != "card "+rules.Redaction || len(redacted.Formats) != 0 {
+		t.Fatalf("Expected the card number redacted and other formats dropped, got %+v", redacted)
+	}
+
+	fake.SetText("123456")
+	var otp socket.ClipData
+	waitFor(t, client, "new_clip", &otp)
+	if otp.ExpiresAt == 0 || otp.ExpiresAt > time.Now().Add(time.Minute).Unix() {
+		t.Fatalf("Expected the code to expire within a minute, got %+v", otp)
+	}
+
+	d.sweepExpired(time.Now().Add(2 * time.Minute))
+	clips := listClips(t, client)
+	if len(clips) != 1 || clips[0].ID != redacted.ID {
+		t.Fatalf("Expected only the redacted clip after the sweep, got %+v", clips)
+	}
+
+	var v socket.RulesTestData
+	request(t, client, socket.SocketMessage{Type: "test_rules", Data: socket.TestRulesCommand{Text: "654321"}}, &v)
+	if v.Drop || v.TTLSeconds != 60 || len(v.Matched) != 1 || v.Matched[0] != "otp" {
+		t.Fatalf("Unexpected test_rules result: %+v", v)
+	}
+}
+
+func TestDaemon_Pause(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	var status socket.CaptureStatusData
+	request(t, client, socket.SocketMessage{Type: "pause"}, &status)
+	if !status.Paused || status.Until != 0 {
+		t.Fatalf("Expected an open-ended pause, got %+v", status)
+	}
+
+	fake.SetText("password")
+	request(t, client, socket.SocketMessage{Type: "resume"}, &status)
+	if status.Paused {
+		t.Fatalf("Expected capture to resume, got %+v", status)
+	}
+
+	// The text copied while paused is not recorded after resuming either
+	fake.SetText("public")
+	var clip socket.ClipData
+	waitFor(t, client, "new_clip", &clip)
+	if clip.Content != "public" {
+		t.Fatalf("Expected only the clip copied after resuming, got %+v", clip)
+	}
+	if clips := listClips(t, client); len(clips) != 1 {
+		t.Fatalf("Expected one clip, got %+v", clips)
+	}
+
+	// A timed pause resumes by itself and says so
+	request(t, client, socket.SocketMessage{Type: "pause", Data: socket.PauseCommand{DurationMS: 50}}, &status)
+	if !status.Paused || status.Until == 0 {
+		t.Fatalf("Expected a timed pause, got %+v", status)
+	}
+	for status.Paused {
+		waitFor(t, client, "capture_status", &status)
+	}
+	request(t, client, socket.SocketMessage{Type: "capture_status"}, &status)
+	if status.Paused {
+		t.Fatalf("Expected capture to have resumed, got %+v", status)
+	}
+}
+
+// waitForClipboard polls the fake clipboard until its text is want
+func waitForClipboard(t *testing.T, fake *clipboard.FakeBackend, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for string(fake.Formats()[clipboard.MIMEText]) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected clipboard %q, got %q", want, fake.Formats()[clipboard.MIMEText])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDaemon_SensitiveClear(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SensitiveClearAfter = config.Duration(50 * time.Millisecond)
+	cfg.Rules = []config.Rule{{Pattern: "^pw:", Action: config.ActionSensitive}}
+	fake, client, _ := startDaemon(t, cfg)
+
+	fake.SetText("pw:hunter2")
+	var secret socket.ClipData
+	waitFor(t, client, "new_clip", &secret)
+	if !secret.Sensitive {
+		t.Fatalf("Expected the rule to mark the clip sensitive, got %+v", secret)
+	}
+	fake.SetText("public")
+	var public socket.ClipData
+	waitFor(t, client, "new_clip", &public)
+
+	var copied socket.CopyClipData
+	request(t, client, socket.SocketMessage{Type: "copy_clip", Data: socket.CopyClipCommand{ID: secret.ID}}, &copied)
+	if copied.ClearAt == 0 {
+		t.Fatalf("Expected a scheduled clear, got %+v", copied)
+	}
+	waitForClipboard(t, fake, "")
+
+	// Non-sensitive clips stay
+	copied = socket.CopyClipData{}
+	request(t, client, socket.SocketMessage{Type: "copy_clip", Data: socket.CopyClipCommand{ID: public.ID}}, &copied)
+	if copied.ClearAt != 0 {
+		t.Fatalf("Expected no clear for a normal clip, got %+v", copied)
+	}
+
+	// A clip marked by hand is cleared too, unless something else was copied meanwhile
+	request(t, client, socket.SocketMessage{Type: "set_sensitive", Data: socket.SetSensitiveCommand{ID: public.ID, Sensitive: true}}, nil)
+	request(t, client, socket.SocketMessage{Type: "copy_clip", Data: socket.CopyClipCommand{ID: public.ID}}, &copied)
+	fake.SetText("newer")
+	time.Sleep(150 * time.Millisecond)
+	waitForClipboard(t, fake, "newer")
+
+	// Clearing is not recorded as a clip
+	for _, clip := range listClips(t, client) {
+		if clip.Content == "" {
+			t.Fatalf("Expected the clear not to be captured, got %+v", clip)
+		}
+	}
+}
+
+func TestDaemon_SensitiveRestoreAndCancel(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SensitiveClearAfter = config.Duration(50 * time.Millisecond)
+	cfg.SensitiveRestore = true
+	fake, client, d := startDaemon(t, cfg)
+
+	fake.SetText("token")
+	var secret socket.ClipData
+	waitFor(t, client, "new_clip", &secret)
+	request(t, client, socket.SocketMessage{Type: "set_sensitive", Data: socket.SetSensitiveCommand{ID: secret.ID, Sensitive: true}}, nil)
+	fake.Set(map[string][]byte{clipboard.MIMEText: []byte("before"), clipboard.MIMEHTML: []byte("<b>before</b>")})
+	waitFor(t, client, "new_clip", nil)
+
+	request(t, client, socket.SocketMessage{Type: "copy_clip", Data: socket.CopyClipCommand{ID: secret.ID}}, nil)
+	waitForClipboard(t, fake, "before")
+	if html := string(fake.Formats()[clipboard.MIMEHTML]); html != "<b>before</b>" {
+		t.Fatalf("Expected the previous formats restored, got %q", html)
+	}
+
+	// A canceled clear leaves the clip on the clipboard
+	d.clears.configure(time.Hour, false)
+	request(t, client, socket.SocketMessage{Type: "copy_clip", Data: socket.CopyClipCommand{ID: secret.ID}}, nil)
+	var canceled socket.CancelClearData
+	request(t, client, socket.SocketMessage{Type: "cancel_clear"}, &canceled)
+	if canceled.Canceled != 1 {
+		t.Fatalf("Expected one canceled clear, got %+v", canceled)
+	}
+	if pending := d.cancelClears(); pending != 0 {
+		t.Fatalf("Expected nothing left to cancel, got %d", pending)
+	}
+	waitForClipboard(t, fake, "token")
+}
+
+func TestDaemon_Retention(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MaxAge = config.Duration(time.Hour)
+	fake, client, d := startDaemon(t, cfg)
+
+	var clips [3]socket.ClipData
+	for i, text := range []string{"old", "pinned", "pinned ttl"} {
+		fake.SetText(text)
+		waitFor(t, client, "new_clip", &clips[i])
+	}
+	old, pinned, pinnedTTL := clips[0].ID, clips[1].ID, clips[2].ID
+	request(t, client, socket.SocketMessage{Type: "pin", Data: socket.PinCommand{ID: pinned}}, nil)
+	request(t, client, socket.SocketMessage{Type: "pin", Data: socket.PinCommand{ID: pinnedTTL}}, nil)
+	request(t, client, socket.SocketMessage{Type: "expire", Data: socket.ExpireCommand{ID: pinnedTTL, TTLMS: 60_000}}, nil)
+	if errMsg := requestErr(t, client, socket.SocketMessage{Type: "expire", Data: socket.CommandData{ID: old}}, nil); errMsg == "" {
+		t.Fatal("Expected expire without ttl_ms to fail")
+	}
+
+	for _, clip := range listClips(t, client) {
+		if (clip.ID == pinnedTTL) != (clip.ExpiresAt > 0) {
+			t.Fatalf("Expected only clip %d to carry an expiry, got %+v", pinnedTTL, clip)
+		}
+	}
+
+	// Two hours on, the unpinned clip is past max_age and the pinned one past its ttl
+	d.sweepExpired(time.Now().Add(2 * time.Hour))
+	var removed socket.ClipRemovedData
+	waitFor(t, client, "clip_removed", &removed)
+	if removed.Reason != "expired" || len(removed.IDs) != 2 {
+		t.Fatalf("Expected two expired clips, got %+v", removed)
+	}
+	left := listClips(t, client)
+	if len(left) != 1 || left[0].ID != pinned {
+		t.Fatalf("Expected only the pinned clip without ttl to remain, got %+v", left)
+	}
+}
+
+func TestDaemon_SizeLimits(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.MaxTotalSize = 64
+	cfg.MaxClipSize = 16
+	fake, client, d := startDaemon(t, cfg)
+
+	fake.SetText("this text is well over sixteen bytes")
+	waitSeen(t, fake)
+	fake.SetText("small")
+	var clip socket.ClipData
+	waitFor(t, client, "new_clip", &clip)
+	if clip.Content != "small" {
+		t.Fatalf("Expected the oversize clip to be skipped, got %+v", clip)
+	}
+	if clips := listClips(t, client); len(clips) != 1 || clips[0].Content != "small" {
+		t.Fatalf("Expected the oversize clip never to be stored, got %+v", clips)
+	}
+
+	var stats socket.StatsData
+	request(t, client, socket.SocketMessage{Type: "stats"}, &stats)
+	if stats.Clips != 1 || stats.Bytes != 5 || stats.MaxBytes != 64 || stats.MaxClipSize != 16 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+
+	// With truncation on (as after a reload), long text is cut down instead
+	cfg.OversizePolicy = config.OversizeTruncate
+	if err := applySizeLimits(d.store, cfg); err != nil {
+		t.Fatalf("Failed to apply size limits: %v", err)
+	}
+	fake.SetText("this text is well over sixteen bytes")
+	waitFor(t, client, "new_clip", &clip)
+	if clip.Content != "this text is wel" {
+		t.Fatalf("Expected the text cut to 16 bytes, got %q", clip.Content)
+	}
+}
+
+func TestDaemon_Dedup(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Dedup = config.DedupWhitespace
+	fake, client, _ := startDaemon(t, cfg)
+
+	fake.SetText("select 1")
+	var first, again socket.ClipData
+	waitFor(t, client, "new_clip", &first)
+	fake.SetText("select  1\n")
+	waitFor(t, client, "new_clip", &again)
+	if again.ID != first.ID || again.Content != "select 1" || again.Captures != 2 || again.LastCopied == 0 {
+		t.Fatalf("Expected a hit on clip %d, got %+v", first.ID, again)
+	}
+	if clips := listClips(t, client); len(clips) != 1 {
+		t.Fatalf("Expected 1 clip, got %+v", clips)
+	}
+}
+
+func TestDaemon_Delete(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	var clips [4]socket.ClipData
+	for i, text := range []string{"one", "two", "api key", "pinned"} {
+		fake.SetText(text)
+		waitFor(t, client, "new_clip", &clips[i])
+	}
+	request(t, client, socket.SocketMessage{Type: "pin", Data: socket.PinCommand{ID: clips[3].ID}}, nil)
+
+	if errMsg := requestErr(t, client, socket.SocketMessage{Type: "delete"}, nil); errMsg == "" {
+		t.Fatal("Expected delete without ids or query to fail")
+	}
+
+	var removed socket.ClipRemovedData
+	request(t, client, socket.SocketMessage{Type: "delete", Data: socket.DeleteCommand{IDs: []int64{clips[0].ID, 999}}}, &removed)
+	if len(removed.IDs) != 1 || removed.IDs[0] != clips[0].ID {
+		t.Fatalf("Expected only clip %d deleted, got %+v", clips[0].ID, removed)
+	}
+	var broadcast socket.ClipRemovedData
+	waitFor(t, client, "clip_removed", &broadcast)
+	if broadcast.Reason != "deleted" || len(broadcast.IDs) != 1 || broadcast.IDs[0] != clips[0].ID {
+		t.Fatalf("Expected a deleted broadcast for clip %d, got %+v", clips[0].ID, broadcast)
+	}
+
+	removed = socket.ClipRemovedData{}
+	request(t, client, socket.SocketMessage{Type: "delete", Data: socket.DeleteCommand{Query: "api"}}, &removed)
+	if len(removed.IDs) != 1 || removed.IDs[0] != clips[2].ID {
+		t.Fatalf("Expected clip %d deleted by query, got %+v", clips[2].ID, removed)
+	}
+
+	// Clearing with keep_pinned leaves the pin
+	removed = socket.ClipRemovedData{}
+	request(t, client, socket.SocketMessage{Type: "clear", Data: socket.ClearCommand{KeepPinned: true}}, &removed)
+	if len(removed.IDs) != 1 || removed.IDs[0] != clips[1].ID {
+		t.Fatalf("Expected clip %d cleared, got %+v", clips[1].ID, removed)
+	}
+	left := listClips(t, client)
+	if len(left) != 1 || left[0].ID != clips[3].ID {
+		t.Fatalf("Expected only the pinned clip to remain, got %+v", left)
+	}
+
+	request(t, client, socket.SocketMessage{Type: "clear"}, nil)
+	if left := listClips(t, client); len(left) != 0 {
+		t.Fatalf("Expected no clips after clear, got %+v", left)
+	}
+}
+
+func TestDaemon_Trash(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	var clips [2]socket.ClipData
+	for i, text := range []string{"one", "two"} {
+		fake.SetText(text)
+		waitFor(t, client, "new_clip", &clips[i])
+	}
+	request(t, client, socket.SocketMessage{Type: "pin", Data: socket.PinCommand{ID: clips[0].ID}}, nil)
+	request(t, client, socket.SocketMessage{Type: "delete", Data: socket.DeleteCommand{ID: clips[0].ID}}, nil)
+
+	var trash socket.TrashListData
+	request(t, client, socket.SocketMessage{Type: "trash"}, &trash)
+	if trash.Count != 1 || trash.Clips[0].ID != clips[0].ID || trash.Clips[0].Reason != "deleted" || trash.Clips[0].RemovedAt == 0 {
+		t.Fatalf("Expected clip %d in the trash as deleted, got %+v", clips[0].ID, trash)
+	}
+
+	var restored socket.ClipData
+	request(t, client, socket.SocketMessage{Type: "restore", Data: socket.RestoreCommand{ID: clips[0].ID}}, &restored)
+	if restored.ID != clips[0].ID || !restored.Pinned {
+		t.Fatalf("Expected clip %d restored pinned, got %+v", clips[0].ID, restored)
+	}
+	var announced socket.ClipData
+	waitFor(t, client, "new_clip", &announced)
+	if announced.ID != clips[0].ID {
+		t.Fatalf("Expected new_clip for restored clip %d, got %+v", clips[0].ID, announced)
+	}
+
+	request(t, client, socket.SocketMessage{Type: "clear"}, nil)
+	var undone socket.ClipListData
+	request(t, client, socket.SocketMessage{Type: "undo"}, &undone)
+	if undone.Count != 2 {
+		t.Fatalf("Expected undo to restore 2 clips, got %+v", undone)
+	}
+	if left := listClips(t, client); len(left) != 2 {
+		t.Fatalf("Expected 2 clips after undo, got %+v", left)
+	}
+	if errMsg := requestErr(t, client, socket.SocketMessage{Type: "undo"}, nil); errMsg == "" {
+		t.Fatal("Expected a second undo to fail")
+	}
+}
+
+func TestDaemon_Search(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	for _, text := range []string{"git commit -m", "magic"} {
+		fake.SetText(text)
+		waitFor(t, client, "new_clip", nil)
+	}
+
+	var list socket.ClipListData
+	request(t, client, socket.SocketMessage{Type: "search", Data: socket.SearchCommand{Query: "gc", Limit: 10}}, &list)
+	if list.Count != 2 || list.Clips[0].Content != "git commit -m" {
+		t.Fatalf("Expected the word-start match first, got %+v", list.Clips)
+	}
+	if got := list.Clips[0].MatchPositions; len(got) != 2 || got[0] != 0 || got[1] != 4 {
+		t.Fatalf("Expected match positions [0 4], got %v", got)
+	}
+
+	request(t, client, socket.SocketMessage{Type: "search", Data: socket.SearchCommand{Query: "gc -/^git/", Limit: 10}}, &list)
+	if list.Count != 1 || list.Clips[0].Content != "magic" {
+		t.Fatalf("Expected the regex to exclude the git clip, got %+v", list.Clips)
+	}
+
+	// A bad query fails with where and why
+	if err := client.Send(socket.SocketMessage{Type: "search", Data: socket.SearchCommand{Query: "type:video", Limit: 10}}); err != nil {
+		t.Fatalf("Failed to send search: %v", err)
+	}
+	var resp struct {
+		Success bool                  `json:"success"`
+		Data    socket.QueryErrorData `json:"data"`
+		Error   string                `json:"error"`
+	}
+	waitFor(t, client, "response", &resp)
+	if resp.Success || resp.Error == "" || resp.Data.Token != "type:video" || resp.Data.Message == "" {
+		t.Fatalf("Expected a structured query error, got %+v", resp)
+	}
+}
+
+func TestDaemon_Tags(t *testing.T) {
+	fake, client, _ := startDaemon(t, config.DefaultConfig())
+
+	var clips []socket.ClipData
+	for _, text := range []string{"SELECT 1", "meeting notes", "SELECT 2"} {
+		fake.SetText(text)
+		var clip socket.ClipData
+		waitFor(t, client, "new_clip", &clip)
+		clips = append(clips, clip)
+	}
+
+	var tagged socket.ClipData
+	request(t, client, socket.SocketMessage{Type: "tag", Data: socket.TagCommand{ID: clips[0].ID, Tags: []string{"Work", "sql"}}}, &tagged)
+	if len(tagged.Tags) != 2 || tagged.Tags[0] != "sql" || tagged.Tags[1] != "work" {
+		t.Fatalf("Expected tags [sql work], got %v", tagged.Tags)
+	}
+	request(t, client, socket.SocketMessage{Type: "tag", Data: socket.TagCommand{ID: clips[1].ID, Tags: []string{"work"}}}, nil)
+
+	var tags socket.TagListData
+	request(t, client, socket.SocketMessage{Type: "tags"}, &tags)
+	if tags.Count != 2 || tags.Tags[0] != (socket.TagData{Name: "sql", Count: 1}) || tags.Tags[1] != (socket.TagData{Name: "work", Count: 2}) {
+		t.Fatalf("Expected sql:1 and work:2, got %+v", tags.Tags)
+	}
+
+	var list socket.ClipListData
+	request(t, client, socket.SocketMessage{Type: "list", Data: socket.ListCommand{Limit: 10, Tag: "WORK"}}, &list)
+	if list.Count != 2 || list.Clips[0].ID != clips[1].ID || list.Clips[1].ID != clips[0].ID {
+		t.Fatalf("Expected the two work clips, most recent first, got %+v", list.Clips)
+	}
+	request(t, client, socket.SocketMessage{Type: "search", Data: socket.SearchCommand{Query: "select tag:sql", Limit: 10}}, &list)
+	if list.Count != 1 || list.Clips[0].ID != clips[0].ID {
+		t.Fatalf("Expected only the sql clip, got %+v", list.Clips)
+	}
+
+	var untagged socket.ClipData
+	request(t, client, socket.SocketMessage{Type: "untag", Data: socket.TagCommand{ID: clips[0].ID}}, &untagged)
+	if len(untagged.Tags) != 0 {
+		t.Fatalf("Expected untag without tags to remove them all, got %v", untagged.Tags)
+	}
+
+	if err := requestErr(t, client, socket.SocketMessage{Type: "tag", Data: socket.TagCommand{ID: clips[0].ID, Tags: []string{"no spaces"}}}, nil); err == "" {
+		t.Fatal("Expected error for an invalid tag")
+	}
+	if err := requestErr(t, client, socket.SocketMessage{Type: "tag", Data: socket.TagCommand{ID: 99, Tags: []string{"work"}}}, nil); err == "" {
+		t.Fatal("Expected error tagging a missing clip")
+	}
+}
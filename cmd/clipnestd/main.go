@@ -2,152 +2,163 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"clipnest/internal/clipboard"
 	"clipnest/internal/config"
+	"clipnest/internal/rules"
 	"clipnest/internal/socket"
 	"clipnest/internal/storage"
 )
 
+// thumbnailSize bounds the width and height of image clip previews
+const thumbnailSize = 128
+
 func main() {
-	cfg := config.DefaultConfig()
+	configPath := flag.String("config", "", "path to config file (default: $CLIPNEST_CONFIG or the per-user config dir)")
+	flag.Parse()
 
-	store, err := storage.NewStorage(cfg.MaxMemoryClips)
+	cfg, err := config.Load(*configPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create storage: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
 		os.Exit(1)
 	}
 
-	var server *socket.Server
-
-	// Command handler: dispatches incoming commands from CLI clients
-	handler := func(conn net.Conn, msg socket.SocketMessage) {
-		switch msg.Type {
-		case "list":
-			limit := 20
-			if msg.Data != nil {
-				if m, ok := msg.Data.(map[string]interface{}); ok {
-					if l, ok := m["limit"].(float64); ok && l > 0 {
-						limit = int(l)
-					}
-				}
-			}
-			clips, _ := store.List(limit)
-			sendClipList(conn, clips)
-
-		case "search":
-			query := ""
-			limit := 20
-			if m, ok := msg.Data.(map[string]interface{}); ok {
-				if q, ok := m["query"].(string); ok {
-					query = q
-				}
-				if l, ok := m["limit"].(float64); ok && l > 0 {
-					limit = int(l)
-				}
-			}
-			clips, _ := store.Search(query, limit)
-			sendClipList(conn, clips)
-
-		case "pins":
-			clips, _ := store.GetPinned()
-			sendClipList(conn, clips)
-
-		case "copy_clip":
-			id := extractID(msg)
-			if id == 0 {
-				sendError(conn, "missing clip id")
-				return
-			}
-			clip, err := store.Get(id)
-			if err != nil {
-				sendError(conn, err.Error())
-				return
-			}
-			if err := clipboard.Copy(clip.Content); err != nil {
-				sendError(conn, fmt.Sprintf("failed to copy: %v", err))
-				return
-			}
-			sendOK(conn)
+	if err := config.EnsureDirectories(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create directories: %v\n", err)
+		os.Exit(1)
+	}
 
-		case "pin":
-			id := extractID(msg)
-			if id == 0 {
-				sendError(conn, "missing clip id")
-				return
-			}
-			if err := store.Pin(id); err != nil {
-				sendError(conn, err.Error())
-				return
-			}
-			sendOK(conn)
+	store, err := openStorage(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create storage: %v\n", err)
+		os.Exit(1)
+	}
 
-		case "unpin":
-			id := extractID(msg)
-			if id == 0 {
-				sendError(conn, "missing clip id")
-				return
-			}
-			if err := store.Unpin(id); err != nil {
-				sendError(conn, err.Error())
-				return
-			}
-			sendOK(conn)
+	// The session clipboard; wl-clipboard/xclip and owning the selection
+	// (natively on Wayland, else on X11) are optional helpers shared by both selections
+	command := clipboard.NewCommandClipboard()
+	var owner clipboard.SelectionOwner // nil without a display
+	if wl, err := clipboard.NewWaylandOwner(); err == nil {
+		defer wl.Close()
+		owner = wl
+	} else if x, err := clipboard.NewX11Owner(); err == nil {
+		defer x.Close()
+		owner = x
+	}
+	backends := make(map[string]clipboard.Backend)
+	for _, selection := range []string{clipboard.SelectionClipboard, clipboard.SelectionPrimary} {
+		if backend, err := clipboard.NewSystemBackend(selection, command, owner); err == nil {
+			backends[selection] = backend
+		}
+	}
 
-		case "clear":
-			_ = store.Clear()
-			sendOK(conn)
+	// Selections to record; PRIMARY is read through wl-paste/xclip
+	selections := []string{clipboard.SelectionClipboard}
+	if cfg.PrimarySelection {
+		if command != nil {
+			selections = append(selections, clipboard.SelectionPrimary)
+		} else {
+			fmt.Fprintln(os.Stderr, "primary_selection needs wl-clipboard or xclip; recording CLIPBOARD only")
+		}
+	}
 
-		default:
-			sendError(conn, fmt.Sprintf("unknown command: %s", msg.Type))
+	// Change notifications from the session, or polling; chosen before anything else starts
+	watchers := make(map[string]clipboard.Watcher)
+	for _, selection := range selections {
+		watcher, err := clipboard.NewWatcher(cfg.Watcher, selection, time.Duration(cfg.PollInterval))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start %s watcher: %v\n", selection, err)
+			os.Exit(1)
 		}
+		watchers[selection] = watcher
 	}
 
-	server, err = socket.NewServer(cfg.SocketPath, handler)
+	d, err := newDaemon(cfg, store, backends, watchers)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to start socket server: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to start: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Clipboard monitor: detects changes and stores them
-	monitor := clipboard.NewMonitor(500*time.Millisecond, func(content, clipType string) {
-		clip := storage.Clip{
-			Content:   content,
-			Type:      clipType,
-			Timestamp: time.Now(),
+	fmt.Printf("clipnestd running (socket: %s, db: %s, max clips: %d, watcher: %s, selections: %s)\n",
+		cfg.SocketPath, cfg.DBPath, cfg.MaxMemoryClips, watchers[clipboard.SelectionClipboard].Name(),
+		strings.Join(selections, ", "))
+
+	// Wait for shutdown signal; SIGHUP reloads the config
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigCh {
+		if sig != syscall.SIGHUP {
+			break
 		}
-		id, err := store.Add(clip)
+		newCfg, err := config.Load(*configPath)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to store clip: %v\n", err)
-			return
+			fmt.Fprintf(os.Stderr, "Config reload failed, keeping current config: %v\n", err)
+			continue
 		}
+		d.reload(newCfg)
+	}
 
-		// Broadcast to connected clients
-		stored, _ := store.Get(id)
-		_ = server.Broadcast(socket.SocketMessage{
-			Type: "new_clip",
-			Data: clipToData(stored),
-		})
-	})
-	monitor.Start()
+	fmt.Println("\nShutting down...")
+	d.close()
+	store.Close()
+}
+
+// openStorage builds Storage over the backend selected in the config
+func openStorage(cfg config.Config) (*storage.Storage, error) {
+	switch cfg.StorageBackend {
+	case config.BackendMemory:
+		return storage.NewStorage(cfg.MaxMemoryClips)
+	case config.BackendSQLite:
+		disk, err := storage.NewSQLiteStore(cfg.DBPath)
+		if err != nil {
+			return nil, err
+		}
+		store, err := storage.NewStorageWithBackend(disk, cfg.MaxMemoryClips)
+		if err != nil {
+			disk.Close()
+			return nil, err
+		}
+		return store, nil
+	case config.BackendTiered:
+		return storage.OpenStorage(cfg.MaxMemoryClips, cfg.DBPath, cfg.HotClips)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+	}
+}
 
-	fmt.Printf("clipnestd running (socket: %s, max clips: %d)\n", cfg.SocketPath, cfg.MaxMemoryClips)
+// ruleSet holds the compiled ignore rules, swapped on config reload
+type ruleSet struct {
+	mu     sync.RWMutex
+	engine *rules.Engine
+}
 
-	// Wait for shutdown signal
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+// load compiles the config's ignore patterns and rules and replaces the current ones
+func (r *ruleSet) load(cfg config.Config) error {
+	engine, err := rules.New(cfg)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.engine = engine
+	r.mu.Unlock()
+	return nil
+}
 
-	fmt.Println("\nShutting down...")
-	monitor.Stop()
-	server.Close()
-	store.Close()
+// evaluate applies the current rules to captured text
+func (r *ruleSet) evaluate(text string) rules.Verdict {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.engine.Evaluate(text)
 }
 
 func extractID(msg socket.SocketMessage) int64 {
@@ -165,6 +176,47 @@ func extractID(msg socket.SocketMessage) int64 {
 	return int64(id)
 }
 
+// extractIDs returns the clip IDs of a command: its "ids" list plus its "id"
+func extractIDs(msg socket.SocketMessage) []int64 {
+	var ids []int64
+	if m, ok := msg.Data.(map[string]interface{}); ok {
+		if list, ok := m["ids"].([]interface{}); ok {
+			for _, v := range list {
+				if id, ok := v.(float64); ok && id > 0 {
+					ids = append(ids, int64(id))
+				}
+			}
+		}
+	}
+	if id := extractID(msg); id > 0 {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// extractTags returns the "tags" list of a command
+func extractTags(msg socket.SocketMessage) []string {
+	var tags []string
+	if m, ok := msg.Data.(map[string]interface{}); ok {
+		list, _ := m["tags"].([]interface{})
+		for _, v := range list {
+			if tag, ok := v.(string); ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// sortOrder returns the "sort" of a command, or def if it has none
+func sortOrder(msg socket.SocketMessage, def storage.SortOrder) (storage.SortOrder, error) {
+	name := ""
+	if m, ok := msg.Data.(map[string]interface{}); ok {
+		name, _ = m["sort"].(string)
+	}
+	return storage.ParseSortOrder(name, def)
+}
+
 func clipToData(c storage.Clip) socket.ClipData {
 	return socket.ClipData{
 		ID:        c.ID,
@@ -172,7 +224,103 @@ func clipToData(c storage.Clip) socket.ClipData {
 		Type:      c.Type,
 		Timestamp: c.Timestamp.Unix(),
 		Pinned:    c.Pinned,
+		Sensitive: c.Sensitive,
+		Width:     c.Width,
+		Height:    c.Height,
+		Thumbnail: c.Thumbnail,
+		Source:    c.Source,
+		Formats:   formatNames(c),
+		Files:     filesToData(c.Files),
+		ExpiresAt: unixOrZero(c.ExpiresAt),
+
+		Captures:   c.Captures(),
+		LastCopied: unixOrZero(c.LastCopied),
+		Copies:     c.Copies,
+		LastUsed:   unixOrZero(c.LastUsed),
+		Frecency:   c.Frecency(time.Now()),
+		Tags:       c.Tags,
+	}
+}
+
+// unixOrZero converts t to Unix seconds, keeping the zero time as 0
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// statFiles records whether each copied path exists and its size
+func statFiles(paths []string) []storage.File {
+	files := make([]storage.File, len(paths))
+	for i, p := range paths {
+		files[i].Path = p
+		if info, err := os.Stat(p); err == nil {
+			files[i].Exists = true
+			if info.Mode().IsRegular() {
+				files[i].Size = info.Size()
+			}
+		}
 	}
+	return files
+}
+
+// clipFormats returns every representation of a clip by MIME type
+func clipFormats(clip storage.Clip) map[string][]byte {
+	switch clip.Type {
+	case "image":
+		return map[string][]byte{clipboard.MIMEPNG: clip.Data}
+	case "files":
+		paths := make([]string, len(clip.Files))
+		for i, f := range clip.Files {
+			paths[i] = f.Path
+		}
+		return clipboard.FileFormats(paths)
+	}
+	formats := map[string][]byte{clipboard.MIMEText: []byte(clip.Content)}
+	for mime, data := range clip.Formats {
+		formats[mime] = data
+	}
+	return formats
+}
+
+// filesToData converts a clip's file list for the socket
+func filesToData(files []storage.File) []socket.FileData {
+	if len(files) == 0 {
+		return nil
+	}
+	data := make([]socket.FileData, len(files))
+	for i, f := range files {
+		data[i] = socket.FileData{Path: f.Path, Exists: f.Exists, Size: f.Size}
+	}
+	return data
+}
+
+// formatNames returns the sorted MIME types of a clip's extra representations
+func formatNames(c storage.Clip) []string {
+	if len(c.Formats) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(c.Formats))
+	for mime := range c.Formats {
+		names = append(names, mime)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// clipFormat returns one MIME representation of a clip
+func clipFormat(c storage.Clip, mime string) ([]byte, bool) {
+	switch {
+	case mime == clipboard.MIMEText && c.Type == "text":
+		return []byte(c.Content), true
+	case mime == clipboard.MIMEPNG && c.Type == "image":
+		return c.Data, true
+	case mime == clipboard.MIMEURIList && c.Type == "files":
+		return clipFormats(c)[mime], true
+	}
+	data, ok := c.Formats[mime]
+	return data, ok
 }
 
 func sendClipList(conn net.Conn, clips []storage.Clip) {
@@ -191,12 +339,25 @@ func sendClipList(conn net.Conn, clips []storage.Clip) {
 	_ = socket.SendMessage(conn, socket.SocketMessage{Type: "response", Data: json.RawMessage(data)})
 }
 
+func sendData(conn net.Conn, payload interface{}) {
+	resp := socket.ResponseMessage{Success: true, Data: payload}
+	data, _ := json.Marshal(resp)
+	_ = socket.SendMessage(conn, socket.SocketMessage{Type: "response", Data: json.RawMessage(data)})
+}
+
 func sendOK(conn net.Conn) {
 	resp := socket.ResponseMessage{Success: true}
 	data, _ := json.Marshal(resp)
 	_ = socket.SendMessage(conn, socket.SocketMessage{Type: "response", Data: json.RawMessage(data)})
 }
 
+// sendErrorData fails a command with details a client can act on
+func sendErrorData(conn net.Conn, errMsg string, payload interface{}) {
+	resp := socket.ResponseMessage{Success: false, Error: errMsg, Data: payload}
+	data, _ := json.Marshal(resp)
+	_ = socket.SendMessage(conn, socket.SocketMessage{Type: "response", Data: json.RawMessage(data)})
+}
+
 func sendError(conn net.Conn, errMsg string) {
 	resp := socket.ResponseMessage{Success: false, Error: errMsg}
 	data, _ := json.Marshal(resp)
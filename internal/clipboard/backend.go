@@ -0,0 +1,99 @@
+package clipboard
+
+import (
+	"fmt"
+
+	"github.com/atotto/clipboard"
+)
+
+// Backend reads and writes one selection; the Monitor reads through it and
+// clipnestd restores clips through it
+type Backend interface {
+	TextReader
+	MIMEReader
+	FormatWriter
+}
+
+// SelectionOwner serves several formats at once by owning a selection;
+// X11Owner and WaylandOwner implement it
+type SelectionOwner interface {
+	WriteSelection(selection string, formats map[string][]byte) error
+}
+
+// SystemBackend is the session's real clipboard for one selection. Text goes
+// through the OS clipboard API (wl-paste/xclip for PRIMARY), typed data through
+// wl-clipboard/xclip, and several formats at once by owning the selection.
+type SystemBackend struct {
+	selection string
+	command   *CommandClipboard // nil without wl-clipboard/xclip
+	owner     SelectionOwner    // nil without a display we can own selections on
+}
+
+// NewSystemBackend returns the system clipboard for selection (SelectionClipboard
+// or SelectionPrimary). command and owner are optional and may be shared
+// between selections; PRIMARY needs at least one of them.
+func NewSystemBackend(selection string, command *CommandClipboard, owner SelectionOwner) (*SystemBackend, error) {
+	b := &SystemBackend{selection: selection, owner: owner}
+	if command != nil {
+		b.command = command.ForSelection(selection)
+	}
+	if selection == SelectionPrimary && command == nil && owner == nil {
+		return nil, fmt.Errorf("the primary selection needs wl-clipboard, xclip or an X display")
+	}
+	return b, nil
+}
+
+// ReadText returns the selection as plain text
+func (b *SystemBackend) ReadText() (string, error) {
+	if b.selection == SelectionClipboard {
+		return clipboard.ReadAll()
+	}
+	if b.command == nil {
+		return "", fmt.Errorf("reading the %s selection needs wl-clipboard or xclip", b.selection)
+	}
+	return b.command.ReadText()
+}
+
+// Targets lists the offered MIME types; none without wl-clipboard/xclip
+func (b *SystemBackend) Targets() ([]string, error) {
+	if b.command == nil {
+		return nil, nil
+	}
+	return b.command.Targets()
+}
+
+// ReadMIME returns the data for one MIME type
+func (b *SystemBackend) ReadMIME(mime string) ([]byte, error) {
+	if b.command == nil {
+		return nil, fmt.Errorf("reading %s needs wl-clipboard or xclip", mime)
+	}
+	return b.command.ReadMIME(mime)
+}
+
+// WriteFormats puts formats on the selection with the best tool available.
+// Owning the selection is needed to offer several formats at once;
+// otherwise images and file lists go through wl-copy/xclip and text through
+// the system clipboard API.
+func (b *SystemBackend) WriteFormats(formats map[string][]byte) error {
+	png, isImage := formats[MIMEPNG]
+	uris, isFiles := formats[MIMEURIList]
+	text, isText := formats[MIMEText]
+	switch {
+	case isImage && b.command != nil:
+		return b.command.WriteMIME(MIMEPNG, png)
+	case len(formats) > 1 && b.owner != nil:
+		return b.owner.WriteSelection(b.selection, formats)
+	case isFiles && b.command != nil:
+		return b.command.WriteMIME(MIMEURIList, uris)
+	case !isText:
+		return fmt.Errorf("this content can't be copied on this system")
+	case b.selection == SelectionClipboard:
+		return clipboard.WriteAll(string(text))
+	case b.owner != nil:
+		return b.owner.WriteSelection(b.selection, formats)
+	case b.command != nil:
+		return b.command.WriteText(string(text))
+	default:
+		return fmt.Errorf("the %s selection is not supported on this system", b.selection)
+	}
+}
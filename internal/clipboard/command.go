@@ -0,0 +1,100 @@
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CommandClipboard implements MIMEClipboard by running wl-clipboard
+// (Wayland) or xclip (X11)
+type CommandClipboard struct {
+	wayland   bool
+	selection string
+}
+
+// NewCommandClipboard picks wl-clipboard under Wayland and xclip under X11.
+// It returns nil when no display or tool is available (e.g. on macOS).
+func NewCommandClipboard() *CommandClipboard {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-paste"); err == nil {
+			return &CommandClipboard{wayland: true, selection: SelectionClipboard}
+		}
+	}
+	if os.Getenv("DISPLAY") != "" {
+		if _, err := exec.LookPath("xclip"); err == nil {
+			return &CommandClipboard{selection: SelectionClipboard}
+		}
+	}
+	return nil
+}
+
+// ForSelection returns a CommandClipboard that reads and writes the given
+// selection (SelectionClipboard or SelectionPrimary) instead
+func (c *CommandClipboard) ForSelection(selection string) *CommandClipboard {
+	cp := *c
+	cp.selection = selection
+	return &cp
+}
+
+// command builds a wl-clipboard or xclip invocation for c's selection;
+// wlArgs and xArgs are the tool-specific arguments
+func (c *CommandClipboard) command(wlTool string, wlArgs, xArgs []string) *exec.Cmd {
+	if c.wayland {
+		if c.selection == SelectionPrimary {
+			wlArgs = append([]string{"--primary"}, wlArgs...)
+		}
+		return exec.Command(wlTool, wlArgs...)
+	}
+	return exec.Command("xclip", append([]string{"-selection", c.selection}, xArgs...)...)
+}
+
+// Targets lists the MIME types currently offered by the clipboard
+func (c *CommandClipboard) Targets() ([]string, error) {
+	out, err := c.command("wl-paste", []string{"--list-types"}, []string{"-t", "TARGETS", "-o"}).Output()
+	if err != nil {
+		// Both tools fail when the clipboard is empty
+		return nil, nil
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// ReadMIME returns the clipboard data for one MIME type
+func (c *CommandClipboard) ReadMIME(mime string) ([]byte, error) {
+	out, err := c.command("wl-paste", []string{"--no-newline", "--type", mime}, []string{"-t", mime, "-o"}).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", mime, err)
+	}
+	return out, nil
+}
+
+// WriteMIME puts data on the clipboard as the given MIME type
+func (c *CommandClipboard) WriteMIME(mime string, data []byte) error {
+	cmd := c.command("wl-copy", []string{"--type", mime}, []string{"-t", mime, "-i"})
+	cmd.Stdin = bytes.NewReader(data)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", mime, err)
+	}
+	return nil
+}
+
+// ReadText returns the selection as plain text, letting the tool pick the text target
+func (c *CommandClipboard) ReadText() (string, error) {
+	out, err := c.command("wl-paste", []string{"--no-newline"}, []string{"-o"}).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read text: %w", err)
+	}
+	return string(out), nil
+}
+
+// WriteText puts plain text on the selection
+func (c *CommandClipboard) WriteText(text string) error {
+	cmd := c.command("wl-copy", nil, []string{"-i"})
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write text: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package clipboard
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FakeBackend is an in-memory clipboard for tests. Set and SetText script a
+// change as if another app had copied; every change, including writes
+// through WriteFormats, is signaled to the watcher returned by Watcher.
+type FakeBackend struct {
+	mu      sync.Mutex
+	formats map[string][]byte
+	writes  int
+	seen    bool // the text was read since the last change
+	events  chan struct{}
+	closed  bool
+}
+
+// NewFakeBackend returns an empty fake clipboard
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{events: make(chan struct{}, 1)}
+}
+
+// SetText replaces the clipboard with plain text
+func (f *FakeBackend) SetText(text string) {
+	f.Set(map[string][]byte{MIMEText: []byte(text)})
+}
+
+// Set replaces the clipboard with formats (MIME type -> data)
+func (f *FakeBackend) Set(formats map[string][]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(formats)
+}
+
+// Formats returns a copy of the current clipboard contents
+func (f *FakeBackend) Formats() map[string][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	formats := make(map[string][]byte, len(f.formats))
+	for mime, data := range f.formats {
+		formats[mime] = data
+	}
+	return formats
+}
+
+// Writes returns how many times WriteFormats was called
+func (f *FakeBackend) Writes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writes
+}
+
+// Seen reports whether the text was read since the clipboard last changed,
+// so a test can tell a change was looked at even when nothing came of it
+func (f *FakeBackend) Seen() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seen
+}
+
+// Watcher returns a Watcher that signals on every change
+func (f *FakeBackend) Watcher() Watcher {
+	return fakeWatcher{f}
+}
+
+// ReadText returns the text/plain data ("" when there is none)
+func (f *FakeBackend) ReadText() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen = true
+	return string(f.formats[MIMEText]), nil
+}
+
+// Targets lists the stored MIME types in sorted order
+func (f *FakeBackend) Targets() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	targets := make([]string, 0, len(f.formats))
+	for mime := range f.formats {
+		targets = append(targets, mime)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// ReadMIME returns the data for one MIME type
+func (f *FakeBackend) ReadMIME(mime string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.formats[mime]
+	if !ok {
+		return nil, fmt.Errorf("no %s on the clipboard", mime)
+	}
+	return data, nil
+}
+
+// WriteFormats replaces the clipboard, like Set, and counts the write
+func (f *FakeBackend) WriteFormats(formats map[string][]byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	f.set(formats)
+	return nil
+}
+
+// set copies formats in and signals the watcher; callers hold mu
+func (f *FakeBackend) set(formats map[string][]byte) {
+	f.formats = make(map[string][]byte, len(formats))
+	for mime, data := range formats {
+		f.formats[mime] = data
+	}
+	f.seen = false
+	if !f.closed {
+		notify(f.events)
+	}
+}
+
+// fakeWatcher delivers a FakeBackend's change signals
+type fakeWatcher struct {
+	f *FakeBackend
+}
+
+func (w fakeWatcher) Events() <-chan struct{} {
+	return w.f.events
+}
+
+func (w fakeWatcher) Name() string {
+	return "fake"
+}
+
+// Close ends the event stream
+func (w fakeWatcher) Close() error {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	if !w.f.closed {
+		w.f.closed = true
+		close(w.f.events)
+	}
+	return nil
+}
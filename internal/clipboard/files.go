@@ -0,0 +1,50 @@
+package clipboard
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+)
+
+// MIMEGnomeFiles is the GNOME file-manager flavor ("copy" or "cut", then one URI per line)
+const MIMEGnomeFiles = "x-special/gnome-copied-files"
+
+// ParseURIList parses a text/uri-list into local file paths. ok is false
+// unless there is at least one entry and every entry is a file:// URI on this host.
+func ParseURIList(data []byte) (paths []string, ok bool) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme != "file" || (u.Host != "" && u.Host != "localhost") || u.Path == "" {
+			return nil, false
+		}
+		paths = append(paths, u.Path)
+	}
+	return paths, len(paths) > 0
+}
+
+// FileURIList encodes paths as a text/uri-list (CRLF-terminated, per RFC 2483)
+func FileURIList(paths []string) []byte {
+	var buf bytes.Buffer
+	for _, p := range paths {
+		u := url.URL{Scheme: "file", Path: p}
+		buf.WriteString(u.String())
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+// FileFormats returns the representations that let file managers paste paths:
+// a uri-list, GNOME's copied-files flavor and the paths as plain text
+func FileFormats(paths []string) map[string][]byte {
+	uris := FileURIList(paths)
+	gnome := append([]byte("copy\n"), bytes.ReplaceAll(bytes.TrimRight(uris, "\r\n"), []byte("\r\n"), []byte("\n"))...)
+	return map[string][]byte{
+		MIMEURIList:    uris,
+		MIMEGnomeFiles: gnome,
+		MIMEText:       []byte(strings.Join(paths, "\n")),
+	}
+}
@@ -0,0 +1,44 @@
+package clipboard
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseURIList(t *testing.T) {
+	data := []byte("# copied from nautilus\r\nfile:///home/user/My%20Notes.txt\r\nfile://localhost/tmp/a\r\n")
+	paths, ok := ParseURIList(data)
+	if !ok {
+		t.Fatal("Expected a file list")
+	}
+	want := []string{"/home/user/My Notes.txt", "/tmp/a"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("Expected %v, got %v", want, paths)
+	}
+
+	// Anything but local files is not a file list
+	for _, list := range []string{"", "# only a comment\n", "https://example.com/\n", "file:///tmp/a\nhttps://example.com/\n", "file://otherhost/tmp/a\n"} {
+		if _, ok := ParseURIList([]byte(list)); ok {
+			t.Fatalf("Expected %q not to parse as a file list", list)
+		}
+	}
+}
+
+func TestFileURIList_RoundTrip(t *testing.T) {
+	paths := []string{"/home/user/My Notes.txt", "/tmp/100%.png"}
+	data := FileURIList(paths)
+	if !strings.HasSuffix(string(data), "\r\n") {
+		t.Fatalf("Expected CRLF-terminated uri-list, got %q", data)
+	}
+
+	parsed, ok := ParseURIList(data)
+	if !ok || !reflect.DeepEqual(parsed, paths) {
+		t.Fatalf("Expected %v after round trip, got %v", paths, parsed)
+	}
+
+	gnome := string(FileFormats(paths)[MIMEGnomeFiles])
+	if !strings.HasPrefix(gnome, "copy\nfile:///home/user/My%20Notes.txt\n") {
+		t.Fatalf("Unexpected GNOME copied-files data %q", gnome)
+	}
+}
@@ -0,0 +1,82 @@
+package clipboard
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+)
+
+// ImageInfo describes a PNG captured from the clipboard
+type ImageInfo struct {
+	Width     int
+	Height    int
+	Hash      string // hex SHA-256 of the PNG data
+	Thumbnail []byte // PNG scaled to fit within the requested size
+}
+
+// InspectImage decodes PNG data, hashes it and renders a thumbnail that fits
+// within maxSize x maxSize (images already that small are reused as-is)
+func InspectImage(data []byte, maxSize int) (ImageInfo, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	bounds := img.Bounds()
+	info := ImageInfo{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Hash:   hex.EncodeToString(sum[:]),
+	}
+
+	if info.Width <= maxSize && info.Height <= maxSize {
+		info.Thumbnail = data
+		return info, nil
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleDown(img, maxSize)); err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	info.Thumbnail = buf.Bytes()
+	return info, nil
+}
+
+// scaleDown shrinks img to fit within maxSize, averaging each source box
+func scaleDown(img image.Image, maxSize int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := maxSize, maxSize
+	if w > h {
+		th = max(1, h*maxSize/w)
+	} else {
+		tw = max(1, w*maxSize/h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := b.Min.Y+ty*h/th, b.Min.Y+(ty+1)*h/th
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := b.Min.X+tx*w/tw, b.Min.X+(tx+1)*w/tw
+
+			var r, g, bl, a, n uint64
+			for y := y0; y < max(y1, y0+1); y++ {
+				for x := x0; x < max(x1, x0+1); x++ {
+					cr, cg, cb, ca := img.At(x, y).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			i := dst.PixOffset(tx, ty)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(bl / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,69 @@
+package clipboard
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testPNG encodes a solid w x h image
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspectImage_Thumbnail(t *testing.T) {
+	data := testPNG(t, 400, 200)
+
+	info, err := InspectImage(data, 100)
+	if err != nil {
+		t.Fatalf("Failed to inspect image: %v", err)
+	}
+	if info.Width != 400 || info.Height != 200 {
+		t.Fatalf("Expected 400x200, got %dx%d", info.Width, info.Height)
+	}
+	if len(info.Hash) != 64 {
+		t.Fatalf("Expected hex SHA-256 hash, got %q", info.Hash)
+	}
+
+	thumb, err := png.Decode(bytes.NewReader(info.Thumbnail))
+	if err != nil {
+		t.Fatalf("Thumbnail is not a PNG: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Fatalf("Expected 100x50 thumbnail, got %dx%d", b.Dx(), b.Dy())
+	}
+	if r, g, b, _ := thumb.At(10, 10).RGBA(); r>>8 != 200 || g>>8 != 100 || b>>8 != 50 {
+		t.Fatalf("Thumbnail colour not preserved: %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestInspectImage_SmallImageReused(t *testing.T) {
+	data := testPNG(t, 16, 16)
+
+	info, err := InspectImage(data, 100)
+	if err != nil {
+		t.Fatalf("Failed to inspect image: %v", err)
+	}
+	if !bytes.Equal(info.Thumbnail, data) {
+		t.Fatal("Expected small image to be its own thumbnail")
+	}
+}
+
+func TestInspectImage_Invalid(t *testing.T) {
+	if _, err := InspectImage([]byte("not a png"), 100); err == nil {
+		t.Fatal("Expected error for invalid PNG data")
+	}
+}
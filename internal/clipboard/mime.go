@@ -0,0 +1,61 @@
+package clipboard
+
+// MIME types read from and written to the clipboard
+const (
+	MIMEText    = "text/plain"
+	MIMEHTML    = "text/html"
+	MIMERTF     = "text/rtf"
+	MIMEURIList = "text/uri-list"
+	MIMEPNG     = "image/png"
+)
+
+// Selections that can be watched and written; PRIMARY (middle-click paste)
+// only exists on X11 and on Wayland compositors that support it
+const (
+	SelectionClipboard = "clipboard"
+	SelectionPrimary   = "primary"
+)
+
+// RichFormats are the extra representations captured alongside plain text
+var RichFormats = []string{MIMEHTML, MIMERTF, MIMEURIList}
+
+// MIMEReader reads typed clipboard data that the plain-text API can't see
+type MIMEReader interface {
+	// Targets lists the MIME types currently offered by the clipboard
+	Targets() ([]string, error)
+	// ReadMIME returns the clipboard data for one MIME type
+	ReadMIME(mime string) ([]byte, error)
+}
+
+// TextReader reads plain text from a selection
+type TextReader interface {
+	ReadText() (string, error)
+}
+
+// MIMEWriter puts typed data on the clipboard
+type MIMEWriter interface {
+	WriteMIME(mime string, data []byte) error
+}
+
+// FormatWriter puts several representations on the clipboard at once, so
+// paste targets can pick the richest one they understand
+type FormatWriter interface {
+	// WriteFormats offers every MIME type -> data pair in formats
+	WriteFormats(formats map[string][]byte) error
+}
+
+// MIMEClipboard reads and writes typed clipboard data
+type MIMEClipboard interface {
+	MIMEReader
+	MIMEWriter
+}
+
+// hasTarget reports whether mime is among the offered targets
+func hasTarget(targets []string, mime string) bool {
+	for _, t := range targets {
+		if t == mime {
+			return true
+		}
+	}
+	return false
+}
@@ -1,97 +1,331 @@
 package clipboard
 
 import (
+	"bytes"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/atotto/clipboard"
 )
 
+// Content is a clipboard snapshot
+type Content struct {
+	Type  string // "text", "image" or "files"
+	Text  string // for files, the paths one per line
+	Data  []byte // PNG data for images
+	Files []string
+
+	// Formats holds extra representations of text (e.g. text/html), by MIME type
+	Formats map[string][]byte
+}
+
+// Equal reports whether two snapshots hold the same primary content
+// (formats are only read once a change is detected)
+func (c Content) Equal(other Content) bool {
+	return c.Type == other.Type && c.Text == other.Text && bytes.Equal(c.Data, other.Data)
+}
+
+// ContentOf returns what Snapshot reads back after formats (MIME type ->
+// data) were written, without the extra formats
+func ContentOf(formats map[string][]byte) Content {
+	content := readBack(formats)
+	if paths, ok := ParseURIList(formats[MIMEURIList]); ok && content.Type == "text" {
+		content = Content{Type: "files", Text: strings.Join(paths, "\n"), Files: paths}
+	}
+	return content
+}
+
+// readBack returns what readClipboard reads after formats were written
+func readBack(formats map[string][]byte) Content {
+	if text := formats[MIMEText]; len(text) > 0 {
+		return Content{Type: "text", Text: string(text)}
+	}
+	if data := formats[MIMEPNG]; len(data) > 0 {
+		return Content{Type: "image", Data: data}
+	}
+	if paths, ok := ParseURIList(formats[MIMEURIList]); ok {
+		return Content{Type: "files", Text: strings.Join(paths, "\n"), Files: paths}
+	}
+	return Content{}
+}
+
+// MIMEData returns every representation of a snapshot by MIME type, ready for WriteFormats
+func (c Content) MIMEData() map[string][]byte {
+	switch c.Type {
+	case "image":
+		return map[string][]byte{MIMEPNG: c.Data}
+	case "files":
+		return FileFormats(c.Files)
+	}
+	formats := map[string][]byte{MIMEText: []byte(c.Text)}
+	for mime, data := range c.Formats {
+		formats[mime] = data
+	}
+	return formats
+}
+
 // Monitor watches clipboard for changes
 type Monitor struct {
-	lastContent string
-	lastType    string
-	onChange    func(content, clipType string)
-	interval    time.Duration
-	running     bool
+	last     Content
+	onChange func(Content)
+	backend  Backend
+	interval time.Duration
+	watcher  Watcher
+	running  bool
+	paused   bool
+	mu       sync.Mutex // guards last, interval, watcher, running and paused
+	ioMu     sync.Mutex // held while checking and by Write, so our own writes are never seen as changes
 }
 
-// NewMonitor creates a new clipboard monitor
-func NewMonitor(interval time.Duration, onChange func(content, clipType string)) *Monitor {
+// NewMonitor creates a monitor of backend that polls every interval unless
+// given a Watcher
+func NewMonitor(backend Backend, interval time.Duration, onChange func(Content)) *Monitor {
 	return &Monitor{
+		backend:  backend,
 		interval: interval,
 		onChange: onChange,
 	}
 }
 
+// SetLast records c as the current content, so that writing it to the
+// clipboard ourselves isn't reported as a change
+func (m *Monitor) SetLast(c Content) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = c
+}
+
+// Write puts formats on the monitored clipboard without reporting them as a change
+func (m *Monitor) Write(formats map[string][]byte) error {
+	m.ioMu.Lock()
+	defer m.ioMu.Unlock()
+	if err := m.backend.WriteFormats(formats); err != nil {
+		return err
+	}
+	m.SetLast(readBack(formats))
+	return nil
+}
+
+// SetWatcher replaces polling with change notifications from w; if w stops
+// delivering them the monitor falls back to polling. Call before Start.
+func (m *Monitor) SetWatcher(w Watcher) {
+	m.watcher = w
+}
+
 // Start begins monitoring clipboard changes
 func (m *Monitor) Start() {
+	m.mu.Lock()
 	m.running = true
+	if m.watcher == nil {
+		m.watcher = NewPollWatcher(m.interval)
+	}
+	w := m.watcher
+	m.mu.Unlock()
 
 	// Initialize with current clipboard
-	content, clipType := m.readClipboard()
-	if content != "" {
-		m.lastContent = content
-		m.lastType = clipType
+	if content, ok := readClipboard(m.backend); ok {
+		m.SetLast(content)
 	}
 
-	go m.poll()
+	go m.watch(w)
 }
 
 // Stop stops monitoring
 func (m *Monitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.running = false
+	if m.watcher != nil {
+		m.watcher.Close()
+	}
 }
 
-// poll checks clipboard periodically
-func (m *Monitor) poll() {
-	ticker := time.NewTicker(m.interval)
-	defer ticker.Stop()
+// SetInterval changes the poll interval; a polling monitor picks it up on its next tick
+func (m *Monitor) SetInterval(interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.interval = interval
+	if pw, ok := m.watcher.(*PollWatcher); ok {
+		pw.SetInterval(interval)
+	}
+}
 
-	for m.running {
-		<-ticker.C
+// Pause stops reporting changes until Resume; what is copied meanwhile is
+// neither reported nor remembered
+func (m *Monitor) Pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paused = true
+}
 
-		content, clipType := m.readClipboard()
-		if content == "" {
-			continue
-		}
+// Resume reports changes again. Whatever is on the clipboard at that point
+// counts as seen, so content copied while paused is never reported.
+func (m *Monitor) Resume() {
+	content, ok := readClipboard(m.backend)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.paused {
+		return
+	}
+	if ok {
+		m.last = content
+	}
+	m.paused = false
+}
 
-		// Check if changed
-		if content != m.lastContent || clipType != m.lastType {
-			m.lastContent = content
-			m.lastType = clipType
+// Paused reports whether the monitor is paused
+func (m *Monitor) Paused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
 
-			// Notify callback
-			if m.onChange != nil {
-				m.onChange(content, clipType)
+// isRunning reports whether the monitor is running
+func (m *Monitor) isRunning() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+// fallBack swaps a dead watcher for a poller; ok is false once stopped
+func (m *Monitor) fallBack() (Watcher, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.running {
+		return nil, false
+	}
+	m.watcher = NewPollWatcher(m.interval)
+	return m.watcher, true
+}
+
+// watch checks the clipboard on every watcher signal
+func (m *Monitor) watch(w Watcher) {
+	for {
+		for range w.Events() {
+			if !m.isRunning() {
+				return
 			}
+			m.check()
+		}
+
+		var ok bool
+		if w, ok = m.fallBack(); !ok {
+			return
 		}
 	}
 }
 
-// readClipboard reads the current clipboard content
-func (m *Monitor) readClipboard() (string, string) {
-	content, err := clipboard.ReadAll()
-	if err != nil {
-		return "", "error"
+// check reads the clipboard and reports it if it changed
+func (m *Monitor) check() {
+	if m.Paused() {
+		return
+	}
+	m.ioMu.Lock()
+	content, ok := readClipboard(m.backend)
+	if !ok {
+		m.ioMu.Unlock()
+		return
 	}
 
-	if content != "" {
-		return content, "text"
+	// Check if changed; a pause that began during the read still applies
+	m.mu.Lock()
+	if m.paused {
+		m.mu.Unlock()
+		m.ioMu.Unlock()
+		return
 	}
+	unchanged := content.Equal(m.last)
+	m.last = content
+	m.mu.Unlock()
+	m.ioMu.Unlock()
+	if unchanged {
+		return
+	}
+
+	readFormats(m.backend, &content)
+	detectFiles(&content)
 
-	return "", "unknown"
+	// Notify callback
+	if m.onChange != nil {
+		m.onChange(content)
+	}
 }
 
-// Copy writes content to clipboard
-func Copy(content string) error {
-	return clipboard.WriteAll(content)
+// Snapshot reads everything on the clipboard of backend, as a monitor
+// reports it; ok is false when the clipboard is empty
+func Snapshot(backend Backend) (Content, bool) {
+	content, ok := readClipboard(backend)
+	if !ok {
+		return Content{}, false
+	}
+	readFormats(backend, &content)
+	detectFiles(&content)
+	return content, true
 }
 
-// Read reads current clipboard content
-func Read() (string, string, error) {
-	content, err := clipboard.ReadAll()
+// readClipboard reads the current clipboard content, preferring text over
+// images and file lists when both are offered; ok is false when the clipboard is empty
+func readClipboard(backend Backend) (Content, bool) {
+	text, err := backend.ReadText()
+	if err == nil && text != "" {
+		return Content{Type: "text", Text: text}, true
+	}
+
+	targets, err := backend.Targets()
 	if err != nil {
-		return "", "error", err
+		return Content{}, false
+	}
+	if hasTarget(targets, MIMEPNG) {
+		data, err := backend.ReadMIME(MIMEPNG)
+		if err == nil && len(data) > 0 {
+			return Content{Type: "image", Data: data}, true
+		}
+	}
+	if hasTarget(targets, MIMEURIList) {
+		data, err := backend.ReadMIME(MIMEURIList)
+		if paths, ok := ParseURIList(data); err == nil && ok {
+			return Content{Type: "files", Text: strings.Join(paths, "\n"), Files: paths}, true
+		}
+	}
+	return Content{}, false
+}
+
+// detectFiles turns text that came with a uri-list of local files (a file
+// manager copy) into a "files" snapshot
+func detectFiles(content *Content) {
+	if content.Type != "text" {
+		return
+	}
+	paths, ok := ParseURIList(content.Formats[MIMEURIList])
+	if !ok {
+		return
+	}
+	content.Type = "files"
+	content.Text = strings.Join(paths, "\n")
+	content.Files = paths
+	delete(content.Formats, MIMEURIList)
+}
+
+// readFormats fills in the rich representations offered alongside text
+func readFormats(backend Backend, content *Content) {
+	if content.Type != "text" {
+		return
+	}
+	targets, err := backend.Targets()
+	if err != nil {
+		return
+	}
+
+	for _, mime := range RichFormats {
+		if !hasTarget(targets, mime) {
+			continue
+		}
+		data, err := backend.ReadMIME(mime)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		if content.Formats == nil {
+			content.Formats = make(map[string][]byte)
+		}
+		content.Formats[mime] = data
 	}
-	return content, "text", nil
 }
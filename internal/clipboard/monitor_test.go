@@ -0,0 +1,89 @@
+package clipboard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonitor_Pause(t *testing.T) {
+	fake := NewFakeBackend()
+	var seen []string
+	m := NewMonitor(fake, time.Hour, func(c Content) { seen = append(seen, c.Text) })
+
+	fake.SetText("before")
+	m.check()
+
+	m.Pause()
+	fake.SetText("secret")
+	m.check()
+	if len(seen) != 1 {
+		t.Fatalf("Expected nothing reported while paused, got %v", seen)
+	}
+
+	// What was copied while paused stays unreported after resuming
+	m.Resume()
+	m.check()
+	fake.SetText("after")
+	m.check()
+
+	want := []string{"before", "after"}
+	if len(seen) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, seen)
+		}
+	}
+}
+
+func TestMonitor_Write(t *testing.T) {
+	fake := NewFakeBackend()
+	var seen []string
+	m := NewMonitor(fake, time.Hour, func(c Content) { seen = append(seen, c.Text) })
+
+	fake.SetText("copied")
+	m.check()
+
+	// Our own writes aren't changes, including clearing the clipboard
+	if err := m.Write(map[string][]byte{MIMEText: []byte("restored"), MIMEHTML: []byte("<b>restored</b>")}); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	m.check()
+	if err := m.Write(map[string][]byte{MIMEText: nil}); err != nil {
+		t.Fatalf("Failed to clear: %v", err)
+	}
+	m.check()
+
+	fake.SetText("copied")
+	m.check()
+
+	if len(seen) != 2 || seen[0] != "copied" || seen[1] != "copied" {
+		t.Fatalf("Expected only the two outside copies, got %v", seen)
+	}
+}
+
+func TestContentOf_MatchesSnapshot(t *testing.T) {
+	fake := NewFakeBackend()
+	for _, formats := range []map[string][]byte{
+		{MIMEText: []byte("text"), MIMEHTML: []byte("<i>text</i>")},
+		{MIMEPNG: []byte("png")},
+		FileFormats([]string{"/tmp/a", "/tmp/b"}),
+		{MIMEURIList: FileURIList([]string{"/tmp/c"})},
+	} {
+		fake.Set(formats)
+		snap, ok := Snapshot(fake)
+		if !ok {
+			t.Fatalf("Expected a snapshot of %v", formats)
+		}
+		if want := ContentOf(formats); !want.Equal(snap) {
+			t.Fatalf("ContentOf(%v) = %+v, but the clipboard reads %+v", formats, want, snap)
+		}
+
+		// Writing a snapshot back restores it
+		fake.Set(snap.MIMEData())
+		if again, _ := Snapshot(fake); !again.Equal(snap) {
+			t.Fatalf("Expected %+v after restoring, got %+v", snap, again)
+		}
+	}
+}
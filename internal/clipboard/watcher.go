@@ -0,0 +1,195 @@
+package clipboard
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Watcher kinds accepted by NewWatcher
+const (
+	WatcherAuto    = "auto"    // best available for the session
+	WatcherPoll    = "poll"    // read the clipboard on a timer
+	WatcherWayland = "wayland" // wl-paste --watch
+	WatcherX11     = "x11"     // XFixes selection events
+)
+
+// Watcher signals when the clipboard may have changed; the Monitor reads and
+// compares the content on every signal, so spurious signals are harmless
+type Watcher interface {
+	// Events delivers a signal per change. It is closed once the watcher is
+	// closed or its notification source dies.
+	Events() <-chan struct{}
+	// Name identifies the mechanism, for logging
+	Name() string
+	// Close stops watching
+	Close() error
+}
+
+// NewWatcher returns a watcher of the given kind for selection
+// (SelectionClipboard or SelectionPrimary). WatcherAuto picks wl-paste --watch
+// under Wayland, XFixes under X11 and polling everywhere else; a watcher asked
+// for by name that can't start is an error.
+func NewWatcher(kind, selection string, interval time.Duration) (Watcher, error) {
+	switch kind {
+	case WatcherPoll:
+		return NewPollWatcher(interval), nil
+	case WatcherWayland:
+		return NewWaylandWatcher(selection)
+	case WatcherX11:
+		return NewXFixesWatcher(selection)
+	case WatcherAuto, "":
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			if w, err := NewWaylandWatcher(selection); err == nil {
+				return w, nil
+			}
+		}
+		if os.Getenv("DISPLAY") != "" {
+			if w, err := NewXFixesWatcher(selection); err == nil {
+				return w, nil
+			}
+		}
+		return NewPollWatcher(interval), nil
+	default:
+		return nil, fmt.Errorf("unknown watcher %q", kind)
+	}
+}
+
+// notify signals ch without blocking; one pending signal covers any number of changes
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// PollWatcher signals on every tick of a timer
+type PollWatcher struct {
+	events chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex // guards interval
+	interval time.Duration
+}
+
+// NewPollWatcher starts a watcher that signals every interval
+func NewPollWatcher(interval time.Duration) *PollWatcher {
+	w := &PollWatcher{
+		events:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		interval: interval,
+	}
+	go w.loop()
+	return w
+}
+
+// Events delivers a signal per tick
+func (w *PollWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Name identifies the mechanism
+func (w *PollWatcher) Name() string {
+	return WatcherPoll
+}
+
+// SetInterval changes the tick interval, starting with the next tick
+func (w *PollWatcher) SetInterval(interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.interval = interval
+}
+
+// Close stops the timer
+func (w *PollWatcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
+
+// loop ticks until closed, picking up interval changes
+func (w *PollWatcher) loop() {
+	defer close(w.events)
+
+	interval := w.currentInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		if current := w.currentInterval(); current != interval {
+			interval = current
+			ticker.Reset(interval)
+		}
+		notify(w.events)
+	}
+}
+
+func (w *PollWatcher) currentInterval() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.interval
+}
+
+// WaylandWatcher runs `wl-paste --watch`, which needs a compositor with the
+// wlr data-control protocol (wlroots, KDE); wl-paste exits right away on
+// others, which closes Events
+type WaylandWatcher struct {
+	cmd    *exec.Cmd
+	events chan struct{}
+}
+
+// NewWaylandWatcher starts wl-paste in watch mode for selection
+// (SelectionClipboard or SelectionPrimary)
+func NewWaylandWatcher(selection string) (*WaylandWatcher, error) {
+	if _, err := exec.LookPath("wl-paste"); err != nil {
+		return nil, fmt.Errorf("wl-paste not found: %w", err)
+	}
+
+	// wl-paste runs echo on every selection change; each line is one signal
+	args := []string{"--watch", "echo"}
+	if selection == SelectionPrimary {
+		args = append([]string{"--primary"}, args...)
+	}
+	cmd := exec.Command("wl-paste", args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start wl-paste: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start wl-paste: %w", err)
+	}
+
+	w := &WaylandWatcher{cmd: cmd, events: make(chan struct{}, 1)}
+	go func() {
+		defer close(w.events)
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			notify(w.events)
+		}
+		_ = cmd.Wait()
+	}()
+	return w, nil
+}
+
+// Events delivers a signal per selection change
+func (w *WaylandWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Name identifies the mechanism
+func (w *WaylandWatcher) Name() string {
+	return WatcherWayland
+}
+
+// Close stops wl-paste
+func (w *WaylandWatcher) Close() error {
+	return w.cmd.Process.Kill()
+}
@@ -0,0 +1,55 @@
+package clipboard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollWatcher(t *testing.T) {
+	w := NewPollWatcher(5 * time.Millisecond)
+
+	select {
+	case <-w.Events():
+	case <-time.After(time.Second):
+		t.Fatal("Expected a tick")
+	}
+
+	w.SetInterval(time.Hour)
+	w.Close()
+
+	// Close ends the event stream; at most one pending tick may still arrive
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-w.Events():
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("Expected Events to be closed")
+		}
+	}
+}
+
+func TestNewWatcher(t *testing.T) {
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", "")
+
+	// Without a display, auto falls back to polling
+	w, err := NewWatcher(WatcherAuto, SelectionClipboard, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer w.Close()
+	if w.Name() != WatcherPoll {
+		t.Fatalf("Expected poll watcher, got %s", w.Name())
+	}
+
+	// An explicitly requested watcher must start
+	if _, err := NewWatcher(WatcherX11, SelectionClipboard, time.Second); err == nil {
+		t.Fatal("Expected x11 watcher to fail without DISPLAY")
+	}
+	if _, err := NewWatcher("inotify", SelectionClipboard, time.Second); err == nil {
+		t.Fatal("Expected error for unknown watcher")
+	}
+}
@@ -0,0 +1,413 @@
+package clipboard
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Wayland objects and opcodes WaylandOwner uses. ext-data-control-v1 and
+// wlr-data-control-unstable-v1 share their layout, so one set serves both.
+const (
+	wlDisplayID = 1
+
+	wlDisplaySync        = 0 // request
+	wlDisplayGetRegistry = 1 // request
+	wlDisplayError       = 0 // event
+
+	wlRegistryBind   = 0 // request
+	wlRegistryGlobal = 0 // event
+
+	wlCallbackDone = 0 // event
+
+	dataControlCreateSource = 0 // manager request
+	dataControlGetDevice    = 1 // manager request
+
+	dataControlSetSelection        = 0 // device request
+	dataControlSetPrimarySelection = 2 // device request, version 2
+	dataControlFinished            = 2 // device event
+
+	dataControlOffer         = 0 // source request
+	dataControlSourceDestroy = 1 // source request
+	dataControlSend          = 0 // source event
+	dataControlCancelled     = 1 // source event
+)
+
+// dataControlManagers are the data-control globals WaylandOwner can use,
+// preferred first
+var dataControlManagers = []string{"ext_data_control_manager_v1", "zwlr_data_control_manager_v1"}
+
+// waylandTimeout bounds a round trip to the compositor
+const waylandTimeout = 5 * time.Second
+
+// WaylandOwner serves clipboard data as a Wayland data-control source, so
+// several representations can be offered at once without XWayland, which
+// wl-copy can't do. It speaks the wire protocol itself and needs a
+// compositor with ext-data-control or wlr-data-control (wlroots, KDE).
+type WaylandOwner struct {
+	conn    *net.UnixConn
+	writeMu sync.Mutex // serializes requests
+
+	mu        sync.Mutex
+	nextID    uint32
+	registry  uint32
+	globals   []waylandGlobal
+	manager   uint32
+	device    uint32
+	primary   bool                         // whether the device can set the primary selection
+	sources   map[uint32]map[string][]byte // served data by source; nil once cancelled
+	owned     map[string]uint32            // source by selection
+	callbacks map[uint32]chan struct{}
+	err       error         // why the connection ended
+	closed    chan struct{} // closed when it does
+}
+
+// waylandGlobal is an object the compositor advertises
+type waylandGlobal struct {
+	name    uint32
+	iface   string
+	version uint32
+}
+
+// NewWaylandOwner connects to the compositor named by $WAYLAND_DISPLAY
+func NewWaylandOwner() (*WaylandOwner, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		return nil, fmt.Errorf("WAYLAND_DISPLAY is not set")
+	}
+	if !filepath.IsAbs(display) {
+		display = filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), display)
+	}
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: display, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Wayland compositor: %w", err)
+	}
+	return newWaylandOwner(conn)
+}
+
+// newWaylandOwner binds a seat and a data-control manager over conn
+func newWaylandOwner(conn *net.UnixConn) (*WaylandOwner, error) {
+	o := &WaylandOwner{
+		conn:      conn,
+		nextID:    wlDisplayID + 1,
+		sources:   make(map[uint32]map[string][]byte),
+		owned:     make(map[string]uint32),
+		callbacks: make(map[uint32]chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	go o.loop()
+
+	o.mu.Lock()
+	o.registry = o.allocID()
+	o.mu.Unlock()
+	if err := o.request(wlDisplayID, wlDisplayGetRegistry, o.registry); err != nil {
+		o.Close()
+		return nil, err
+	}
+	if err := o.roundtrip(); err != nil {
+		o.Close()
+		return nil, err
+	}
+
+	o.mu.Lock()
+	var seat, manager *waylandGlobal
+	for i, g := range o.globals {
+		if g.iface == "wl_seat" && seat == nil {
+			seat = &o.globals[i]
+		}
+	}
+	for _, iface := range dataControlManagers {
+		for i, g := range o.globals {
+			if g.iface == iface && manager == nil {
+				manager = &o.globals[i]
+			}
+		}
+	}
+	if seat == nil || manager == nil {
+		o.mu.Unlock()
+		o.Close()
+		return nil, fmt.Errorf("the compositor doesn't offer a seat with data-control")
+	}
+	seatID, managerID, deviceID := o.allocID(), o.allocID(), o.allocID()
+	o.manager, o.device = managerID, deviceID
+	version := min(manager.version, 2)
+	o.primary = version >= 2
+	o.mu.Unlock()
+
+	err := o.request(o.registry, wlRegistryBind, seat.name, seat.iface, uint32(1), seatID)
+	if err == nil {
+		err = o.request(o.registry, wlRegistryBind, manager.name, manager.iface, version, managerID)
+	}
+	if err == nil {
+		err = o.request(managerID, dataControlGetDevice, deviceID, seatID)
+	}
+	if err == nil {
+		err = o.roundtrip()
+	}
+	if err != nil {
+		o.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// WriteSelection offers every representation in formats (MIME type -> data)
+// on selection (SelectionClipboard or SelectionPrimary); MIMEText is also
+// offered as the X11 string targets XWayland clients ask for
+func (o *WaylandOwner) WriteSelection(selection string, formats map[string][]byte) error {
+	set := uint16(dataControlSetSelection)
+	if selection == SelectionPrimary {
+		if !o.primary {
+			return fmt.Errorf("the compositor can't set the primary selection")
+		}
+		set = dataControlSetPrimarySelection
+	}
+
+	served := make(map[string][]byte, len(formats))
+	for mime, data := range formats {
+		if mime == MIMEText {
+			for _, name := range textTargets {
+				served[name] = data
+			}
+			continue
+		}
+		served[mime] = data
+	}
+
+	o.mu.Lock()
+	source := o.allocID()
+	o.sources[source] = served
+	o.owned[selection] = source
+	o.mu.Unlock()
+
+	if err := o.request(o.manager, dataControlCreateSource, source); err != nil {
+		return err
+	}
+	for mime := range served {
+		if err := o.request(source, dataControlOffer, mime); err != nil {
+			return err
+		}
+	}
+	if err := o.request(o.device, set, source); err != nil {
+		return err
+	}
+	return o.roundtrip()
+}
+
+// Close releases the connection (and with it any selections we own)
+func (o *WaylandOwner) Close() error {
+	o.fail(net.ErrClosed)
+	return nil
+}
+
+// allocID returns a new client object ID; o.mu must be held
+func (o *WaylandOwner) allocID() uint32 {
+	id := o.nextID
+	o.nextID++
+	return id
+}
+
+// request sends one request; args are uint32 (also object and new IDs) or string
+func (o *WaylandOwner) request(obj uint32, opcode uint16, args ...interface{}) error {
+	o.writeMu.Lock()
+	defer o.writeMu.Unlock()
+	if _, err := o.conn.Write(waylandMessage(obj, opcode, args...)); err != nil {
+		o.fail(err)
+		return fmt.Errorf("failed to write to the compositor: %w", err)
+	}
+	return nil
+}
+
+// roundtrip waits until the compositor has handled every request sent so far
+func (o *WaylandOwner) roundtrip() error {
+	o.mu.Lock()
+	if o.err != nil {
+		o.mu.Unlock()
+		return o.err
+	}
+	callback := o.allocID()
+	done := make(chan struct{})
+	o.callbacks[callback] = done
+	o.mu.Unlock()
+
+	if err := o.request(wlDisplayID, wlDisplaySync, callback); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-o.closed:
+		return o.err
+	case <-time.After(waylandTimeout):
+		return fmt.Errorf("the compositor didn't answer")
+	}
+}
+
+// fail ends the connection with err, keeping the first reason
+func (o *WaylandOwner) fail(err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return
+	}
+	o.err = err
+	close(o.closed)
+	o.conn.Close()
+}
+
+// loop dispatches events until the connection ends
+func (o *WaylandOwner) loop() {
+	var buf []byte
+	var fds []int
+	chunk := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(4*28)) // the most fds libwayland sends at once
+	for {
+		n, oobn, _, _, err := o.conn.ReadMsgUnix(chunk, oob)
+		if oobn > 0 {
+			fds = append(fds, parseRights(oob[:oobn])...)
+		}
+		if err != nil || n == 0 {
+			if err == nil {
+				err = errors.New("the compositor closed the connection")
+			}
+			o.fail(err)
+			for _, fd := range fds {
+				syscall.Close(fd)
+			}
+			return
+		}
+		buf = append(buf, chunk[:n]...)
+
+		for len(buf) >= 8 {
+			header := binary.NativeEndian.Uint32(buf[4:])
+			size := int(header >> 16)
+			if size < 8 {
+				o.fail(fmt.Errorf("malformed message from the compositor"))
+				return
+			}
+			if len(buf) < size {
+				break
+			}
+			obj := binary.NativeEndian.Uint32(buf)
+			fds = o.dispatch(obj, uint16(header), buf[8:size], fds)
+			buf = append(buf[:0], buf[size:]...)
+		}
+	}
+}
+
+// dispatch handles one event and returns the fds it didn't take
+func (o *WaylandOwner) dispatch(obj uint32, opcode uint16, body []byte, fds []int) []int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch {
+	case obj == wlDisplayID && opcode == wlDisplayError:
+		_, rest := readUint32(body)
+		code, rest := readUint32(rest)
+		message, _ := readString(rest)
+		go o.fail(fmt.Errorf("wayland protocol error %d: %s", code, message))
+
+	case obj == o.registry && opcode == wlRegistryGlobal:
+		name, rest := readUint32(body)
+		iface, rest := readString(rest)
+		version, _ := readUint32(rest)
+		o.globals = append(o.globals, waylandGlobal{name: name, iface: iface, version: version})
+
+	case o.callbacks[obj] != nil && opcode == wlCallbackDone:
+		close(o.callbacks[obj])
+		delete(o.callbacks, obj)
+
+	case obj == o.device && obj != 0 && opcode == dataControlFinished:
+		go o.fail(errors.New("the data-control device was destroyed"))
+
+	case o.isSource(obj) && opcode == dataControlSend:
+		mime, _ := readString(body)
+		if len(fds) == 0 {
+			break
+		}
+		// A cancelled source still takes its fd, and writes nothing to it
+		fd := fds[0]
+		fds = fds[1:]
+		data := o.sources[obj][mime]
+		go func() {
+			f := os.NewFile(uintptr(fd), "wayland-send")
+			_, _ = f.Write(data)
+			f.Close()
+		}()
+
+	case o.sources[obj] != nil && opcode == dataControlCancelled:
+		// Someone else owns the selection now
+		o.sources[obj] = nil
+		for selection, source := range o.owned {
+			if source == obj {
+				delete(o.owned, selection)
+			}
+		}
+		go o.request(obj, dataControlSourceDestroy)
+	}
+	return fds
+}
+
+// isSource reports whether obj is one of our data sources; o.mu must be held
+func (o *WaylandOwner) isSource(obj uint32) bool {
+	_, ok := o.sources[obj]
+	return ok
+}
+
+// waylandMessage encodes a message to obj; args are uint32 (also object and
+// new IDs) or string
+func waylandMessage(obj uint32, opcode uint16, args ...interface{}) []byte {
+	msg := make([]byte, 8, 64)
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			msg = binary.NativeEndian.AppendUint32(msg, v)
+		case string:
+			msg = binary.NativeEndian.AppendUint32(msg, uint32(len(v)+1))
+			msg = append(msg, v...)
+			msg = append(msg, make([]byte, 4-len(v)%4)...) // NUL and padding
+		}
+	}
+	binary.NativeEndian.PutUint32(msg, obj)
+	binary.NativeEndian.PutUint32(msg[4:], uint32(len(msg))<<16|uint32(opcode))
+	return msg
+}
+
+// parseRights returns the fds passed in a control message
+func parseRights(oob []byte) []int {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	var fds []int
+	for _, msg := range msgs {
+		if rights, err := syscall.ParseUnixRights(&msg); err == nil {
+			fds = append(fds, rights...)
+		}
+	}
+	return fds
+}
+
+// readUint32 reads a uint32 argument, or 0 if b is short
+func readUint32(b []byte) (uint32, []byte) {
+	if len(b) < 4 {
+		return 0, nil
+	}
+	return binary.NativeEndian.Uint32(b), b[4:]
+}
+
+// readString reads a NUL-terminated, padded string argument
+func readString(b []byte) (string, []byte) {
+	n, rest := readUint32(b)
+	padded := int(n+3) &^ 3
+	if n == 0 || len(rest) < padded {
+		return "", nil
+	}
+	return string(rest[:n-1]), rest[padded:]
+}
@@ -0,0 +1,199 @@
+package clipboard
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeCompositor speaks just enough of the Wayland protocol to hand out a
+// seat and a wlr data-control manager and record what a client offers
+type fakeCompositor struct {
+	conn *net.UnixConn
+
+	mu        sync.Mutex
+	registry  uint32
+	manager   uint32
+	device    uint32
+	offers    map[uint32][]string // MIME types by source
+	selection uint32
+	primary   uint32
+}
+
+// startCompositor listens on a socket in a temp dir and points
+// WAYLAND_DISPLAY at it
+func startCompositor(t *testing.T) <-chan *fakeCompositor {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wayland-0")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	t.Setenv("WAYLAND_DISPLAY", path)
+
+	accepted := make(chan *fakeCompositor, 1)
+	go func() {
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			return
+		}
+		c := &fakeCompositor{conn: conn, offers: make(map[uint32][]string)}
+		accepted <- c
+		c.serve()
+	}()
+	return accepted
+}
+
+// serve handles requests until the client disconnects
+func (c *fakeCompositor) serve() {
+	defer c.conn.Close()
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			return
+		}
+		obj := binary.NativeEndian.Uint32(header)
+		size := binary.NativeEndian.Uint32(header[4:]) >> 16
+		opcode := uint16(binary.NativeEndian.Uint32(header[4:]))
+		body := make([]byte, size-8)
+		if _, err := io.ReadFull(c.conn, body); err != nil {
+			return
+		}
+		c.handle(obj, opcode, body)
+	}
+}
+
+func (c *fakeCompositor) handle(obj uint32, opcode uint16, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	arg, _ := readUint32(body)
+	switch {
+	case obj == wlDisplayID && opcode == wlDisplayGetRegistry:
+		c.registry = arg
+		c.send(waylandMessage(arg, wlRegistryGlobal, uint32(1), "wl_seat", uint32(7)), nil)
+		c.send(waylandMessage(arg, wlRegistryGlobal, uint32(2), "zwlr_data_control_manager_v1", uint32(2)), nil)
+	case obj == wlDisplayID && opcode == wlDisplaySync:
+		c.send(waylandMessage(arg, wlCallbackDone, uint32(0)), nil)
+	case obj == c.registry && opcode == wlRegistryBind:
+		_, rest := readUint32(body)
+		iface, rest := readString(rest)
+		_, rest = readUint32(rest)
+		id, _ := readUint32(rest)
+		if iface == "zwlr_data_control_manager_v1" {
+			c.manager = id
+		}
+	case obj == c.manager && opcode == dataControlGetDevice:
+		c.device = arg
+	case obj == c.manager && opcode == dataControlCreateSource:
+		c.offers[arg] = nil
+	case obj == c.device && opcode == dataControlSetSelection:
+		c.selection = arg
+	case obj == c.device && opcode == dataControlSetPrimarySelection:
+		c.primary = arg
+	default:
+		if _, ok := c.offers[obj]; ok && opcode == dataControlOffer {
+			mime, _ := readString(body)
+			c.offers[obj] = append(c.offers[obj], mime)
+		}
+	}
+}
+
+// send writes an event, passing fds along with it
+func (c *fakeCompositor) send(msg []byte, fds []int) {
+	var oob []byte
+	if len(fds) > 0 {
+		oob = syscall.UnixRights(fds...)
+	}
+	c.conn.WriteMsgUnix(msg, oob, nil)
+}
+
+// paste asks the client for the selection's data as mime, as a pasting app would
+func (c *fakeCompositor) paste(t *testing.T, source uint32, mime string) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	c.mu.Lock()
+	c.send(waylandMessage(source, dataControlSend, mime), []int{int(w.Fd())})
+	c.mu.Unlock()
+	w.Close()
+
+	r.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", mime, err)
+	}
+	return string(data)
+}
+
+func TestWaylandOwner(t *testing.T) {
+	accepted := startCompositor(t)
+	owner, err := NewWaylandOwner()
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer owner.Close()
+	c := <-accepted
+
+	formats := map[string][]byte{MIMEText: []byte("bold"), MIMEHTML: []byte("<b>bold</b>")}
+	if err := owner.WriteSelection(SelectionClipboard, formats); err != nil {
+		t.Fatalf("Failed to write selection: %v", err)
+	}
+
+	c.mu.Lock()
+	source := c.selection
+	offers := slices.Sorted(slices.Values(c.offers[source]))
+	c.mu.Unlock()
+	for _, mime := range []string{MIMEHTML, MIMEText, "UTF8_STRING"} {
+		if !slices.Contains(offers, mime) {
+			t.Fatalf("Expected %s to be offered, got %v", mime, offers)
+		}
+	}
+
+	if got := c.paste(t, source, MIMEHTML); got != "<b>bold</b>" {
+		t.Fatalf("Expected the HTML, got %q", got)
+	}
+	if got := c.paste(t, source, "UTF8_STRING"); got != "bold" {
+		t.Fatalf("Expected the text, got %q", got)
+	}
+
+	// PRIMARY goes through its own request
+	if err := owner.WriteSelection(SelectionPrimary, formats); err != nil {
+		t.Fatalf("Failed to write primary: %v", err)
+	}
+	c.mu.Lock()
+	primary := c.primary
+	c.mu.Unlock()
+	if primary == 0 || primary == source {
+		t.Fatalf("Expected a new source for PRIMARY, got %d", primary)
+	}
+
+	// A cancelled source answers with nothing
+	c.mu.Lock()
+	c.send(waylandMessage(source, dataControlCancelled), nil)
+	c.mu.Unlock()
+	if err := owner.roundtrip(); err != nil {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+	if got := c.paste(t, source, MIMEHTML); got != "" {
+		t.Fatalf("Expected nothing from a cancelled source, got %q", got)
+	}
+}
+
+func TestWaylandOwner_NoDisplay(t *testing.T) {
+	t.Setenv("WAYLAND_DISPLAY", "")
+	if _, err := NewWaylandOwner(); err == nil {
+		t.Fatal("Expected error without WAYLAND_DISPLAY")
+	}
+}
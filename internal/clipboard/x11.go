@@ -0,0 +1,404 @@
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xfixes"
+	"github.com/jezek/xgb/xproto"
+)
+
+// textTargets are the X11 targets served from the plain-text representation
+var textTargets = []string{"UTF8_STRING", "STRING", "TEXT", MIMEText, "text/plain;charset=utf-8"}
+
+// incrTimeout is how long an INCR transfer waits for the requestor to take
+// the next chunk before it is dropped
+const incrTimeout = 30 * time.Second
+
+// X11Owner serves clipboard data directly as the X11 selection owner, so
+// several representations (plain text, HTML, RTF, ...) can be offered at
+// once, which xclip and wl-copy can't do. Transfers larger than one request
+// use the ICCCM INCR protocol.
+type X11Owner struct {
+	conn    *xgb.Conn
+	win     xproto.Window
+	chunk   int
+	targets xproto.Atom
+	incr    xproto.Atom
+
+	mu        sync.Mutex
+	atoms     map[string]xproto.Atom
+	owned     map[xproto.Atom]*selectionData // by selection atom
+	transfers map[transferKey]*transfer
+}
+
+// selectionData is what we currently serve for one selection
+type selectionData struct {
+	targets []xproto.Atom
+	data    map[xproto.Atom][]byte
+}
+
+// transferKey identifies an INCR transfer by requestor window and property
+type transferKey struct {
+	win  xproto.Window
+	prop xproto.Atom
+}
+
+// transfer is an in-progress INCR transfer
+type transfer struct {
+	target xproto.Atom
+	data   []byte
+	offset int
+	timer  *time.Timer // drops the transfer if the requestor stalls
+}
+
+// NewX11Owner connects to the X server named by $DISPLAY
+func NewX11Owner() (*X11Owner, error) {
+	if os.Getenv("DISPLAY") == "" {
+		return nil, fmt.Errorf("DISPLAY is not set")
+	}
+
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+
+	setup := xproto.Setup(conn)
+	screen := setup.DefaultScreen(conn)
+	win, err := xproto.NewWindowId(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to allocate window: %w", err)
+	}
+	err = xproto.CreateWindowChecked(conn, 0, win, screen.Root, 0, 0, 1, 1, 0,
+		xproto.WindowClassInputOnly, 0, 0, nil).Check()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create window: %w", err)
+	}
+
+	o := &X11Owner{
+		conn:      conn,
+		win:       win,
+		chunk:     min(64*1024, int(setup.MaximumRequestLength)*4-64),
+		atoms:     make(map[string]xproto.Atom),
+		owned:     make(map[xproto.Atom]*selectionData),
+		transfers: make(map[transferKey]*transfer),
+	}
+	if o.targets, err = o.atom("TARGETS"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if o.incr, err = o.atom("INCR"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go o.loop()
+	return o, nil
+}
+
+// WriteFormats takes ownership of CLIPBOARD and serves every representation
+// in formats (MIME type -> data); MIMEText is also offered as the X11 string targets
+func (o *X11Owner) WriteFormats(formats map[string][]byte) error {
+	return o.WriteSelection(SelectionClipboard, formats)
+}
+
+// WriteSelection is WriteFormats for any selection (SelectionClipboard or SelectionPrimary)
+func (o *X11Owner) WriteSelection(selection string, formats map[string][]byte) error {
+	return o.own(strings.ToUpper(selection), formats)
+}
+
+// own takes ownership of the named selection, serving formats
+func (o *X11Owner) own(selection string, formats map[string][]byte) error {
+	sel, err := o.atom(selection)
+	if err != nil {
+		return err
+	}
+
+	served := &selectionData{
+		targets: []xproto.Atom{o.targets},
+		data:    make(map[xproto.Atom][]byte),
+	}
+	add := func(name string, data []byte) error {
+		a, err := o.atom(name)
+		if err != nil {
+			return err
+		}
+		if _, dup := served.data[a]; !dup {
+			served.targets = append(served.targets, a)
+		}
+		served.data[a] = data
+		return nil
+	}
+	for mime, data := range formats {
+		if mime == MIMEText {
+			continue
+		}
+		if err := add(mime, data); err != nil {
+			return err
+		}
+	}
+	if text, ok := formats[MIMEText]; ok {
+		for _, name := range textTargets {
+			if err := add(name, text); err != nil {
+				return err
+			}
+		}
+	}
+
+	o.mu.Lock()
+	o.owned[sel] = served
+	o.mu.Unlock()
+
+	if err := xproto.SetSelectionOwnerChecked(o.conn, o.win, sel, xproto.TimeCurrentTime).Check(); err != nil {
+		return fmt.Errorf("failed to own %s: %w", selection, err)
+	}
+	reply, err := xproto.GetSelectionOwner(o.conn, sel).Reply()
+	if err != nil {
+		return fmt.Errorf("failed to verify %s owner: %w", selection, err)
+	}
+	if reply.Owner != o.win {
+		return fmt.Errorf("another client took %s", selection)
+	}
+	return nil
+}
+
+// Close releases the X connection (and with it any selections we own)
+func (o *X11Owner) Close() error {
+	o.conn.Close()
+	return nil
+}
+
+// atom interns name, caching the result
+func (o *X11Owner) atom(name string) (xproto.Atom, error) {
+	o.mu.Lock()
+	a, ok := o.atoms[name]
+	o.mu.Unlock()
+	if ok {
+		return a, nil
+	}
+
+	reply, err := xproto.InternAtom(o.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, fmt.Errorf("failed to intern atom %s: %w", name, err)
+	}
+
+	o.mu.Lock()
+	o.atoms[name] = reply.Atom
+	o.mu.Unlock()
+	return reply.Atom, nil
+}
+
+// loop dispatches X events until the connection closes
+func (o *X11Owner) loop() {
+	for {
+		ev, err := o.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return // connection closed
+		}
+		if err != nil {
+			continue
+		}
+
+		switch e := ev.(type) {
+		case xproto.SelectionRequestEvent:
+			o.handleRequest(e)
+		case xproto.SelectionClearEvent:
+			// Another client owns the selection now
+			o.mu.Lock()
+			delete(o.owned, e.Selection)
+			o.mu.Unlock()
+		case xproto.PropertyNotifyEvent:
+			if e.State == xproto.PropertyDelete {
+				o.continueTransfer(transferKey{win: e.Window, prop: e.Atom})
+			}
+		}
+	}
+}
+
+// handleRequest answers a SelectionRequest with the requested target, or refuses it
+func (o *X11Owner) handleRequest(e xproto.SelectionRequestEvent) {
+	prop := e.Property
+	if prop == xproto.AtomNone {
+		prop = e.Target // obsolete clients
+	}
+
+	o.mu.Lock()
+	served := o.owned[e.Selection]
+	o.mu.Unlock()
+
+	ok := false
+	if served != nil {
+		if e.Target == o.targets {
+			buf := make([]byte, 4*len(served.targets))
+			for i, a := range served.targets {
+				xgb.Put32(buf[i*4:], uint32(a))
+			}
+			xproto.ChangeProperty(o.conn, xproto.PropModeReplace, e.Requestor, prop,
+				xproto.AtomAtom, 32, uint32(len(served.targets)), buf)
+			ok = true
+		} else if data, found := served.data[e.Target]; found {
+			o.send(e.Requestor, prop, e.Target, data)
+			ok = true
+		}
+	}
+
+	notify := xproto.SelectionNotifyEvent{
+		Time:      e.Time,
+		Requestor: e.Requestor,
+		Selection: e.Selection,
+		Target:    e.Target,
+		Property:  prop,
+	}
+	if !ok {
+		notify.Property = xproto.AtomNone
+	}
+	xproto.SendEvent(o.conn, false, e.Requestor, 0, string(notify.Bytes()))
+}
+
+// send writes data to the requestor's property, starting an INCR transfer if it doesn't fit in one request
+func (o *X11Owner) send(win xproto.Window, prop, target xproto.Atom, data []byte) {
+	if len(data) <= o.chunk {
+		xproto.ChangeProperty(o.conn, xproto.PropModeReplace, win, prop, target, 8, uint32(len(data)), data)
+		return
+	}
+
+	// Watch for the requestor deleting the property, which asks for the next chunk
+	xproto.ChangeWindowAttributes(o.conn, win, xproto.CwEventMask, []uint32{xproto.EventMaskPropertyChange})
+
+	key := transferKey{win: win, prop: prop}
+	t := &transfer{target: target, data: data}
+	t.timer = time.AfterFunc(incrTimeout, func() { o.dropTransfer(key, t) })
+	o.mu.Lock()
+	if old := o.transfers[key]; old != nil {
+		old.timer.Stop()
+	}
+	o.transfers[key] = t
+	o.mu.Unlock()
+
+	size := make([]byte, 4)
+	xgb.Put32(size, uint32(len(data)))
+	xproto.ChangeProperty(o.conn, xproto.PropModeReplace, win, prop, o.incr, 32, 1, size)
+}
+
+// continueTransfer sends the next INCR chunk; a zero-length chunk ends the transfer
+func (o *X11Owner) continueTransfer(key transferKey) {
+	o.mu.Lock()
+	t, ok := o.transfers[key]
+	if !ok {
+		o.mu.Unlock()
+		return
+	}
+	end := min(t.offset+o.chunk, len(t.data))
+	chunk := t.data[t.offset:end]
+	t.offset = end
+	if len(chunk) == 0 {
+		delete(o.transfers, key)
+		t.timer.Stop()
+	} else {
+		t.timer.Reset(incrTimeout)
+	}
+	o.mu.Unlock()
+
+	xproto.ChangeProperty(o.conn, xproto.PropModeReplace, key.win, key.prop, t.target, 8, uint32(len(chunk)), chunk)
+	if len(chunk) == 0 {
+		xproto.ChangeWindowAttributes(o.conn, key.win, xproto.CwEventMask, []uint32{0})
+	}
+}
+
+// dropTransfer abandons t if it is still the transfer for key, e.g. because
+// the requestor went away without deleting the property
+func (o *X11Owner) dropTransfer(key transferKey, t *transfer) {
+	o.mu.Lock()
+	current := o.transfers[key] == t
+	if current {
+		delete(o.transfers, key)
+	}
+	o.mu.Unlock()
+	if current {
+		xproto.ChangeWindowAttributes(o.conn, key.win, xproto.CwEventMask, []uint32{0})
+	}
+}
+
+// XFixesWatcher signals when the owner of an X11 selection changes, using
+// the XFixes extension
+type XFixesWatcher struct {
+	conn   *xgb.Conn
+	events chan struct{}
+}
+
+// NewXFixesWatcher connects to the X server named by $DISPLAY and subscribes
+// to ownership changes of selection (SelectionClipboard or SelectionPrimary)
+func NewXFixesWatcher(selection string) (*XFixesWatcher, error) {
+	if os.Getenv("DISPLAY") == "" {
+		return nil, fmt.Errorf("DISPLAY is not set")
+	}
+
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to X server: %w", err)
+	}
+	if err := xfixes.Init(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("XFixes unavailable: %w", err)
+	}
+	// Selection events need XFixes 2 or later; the version must be negotiated before use
+	if _, err := xfixes.QueryVersion(conn, 5, 0).Reply(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to query XFixes version: %w", err)
+	}
+
+	name := strings.ToUpper(selection)
+	reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to intern atom %s: %w", name, err)
+	}
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	mask := uint32(xfixes.SelectionEventMaskSetSelectionOwner |
+		xfixes.SelectionEventMaskSelectionWindowDestroy |
+		xfixes.SelectionEventMaskSelectionClientClose)
+	if err := xfixes.SelectSelectionInputChecked(conn, root, reply.Atom, mask).Check(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to watch %s: %w", name, err)
+	}
+
+	w := &XFixesWatcher{conn: conn, events: make(chan struct{}, 1)}
+	go w.loop()
+	return w, nil
+}
+
+// Events delivers a signal per selection owner change
+func (w *XFixesWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Name identifies the mechanism
+func (w *XFixesWatcher) Name() string {
+	return WatcherX11
+}
+
+// Close releases the X connection
+func (w *XFixesWatcher) Close() error {
+	w.conn.Close()
+	return nil
+}
+
+// loop forwards selection events until the connection closes
+func (w *XFixesWatcher) loop() {
+	defer close(w.events)
+	for {
+		ev, err := w.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return // connection closed
+		}
+		if _, ok := ev.(xfixes.SelectionNotifyEvent); ok {
+			notify(w.events)
+		}
+	}
+}
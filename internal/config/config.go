@@ -1,54 +1,685 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
 // Config for the application
 type Config struct {
-	MaxMemoryClips int    `json:"max_memory_clips"` // Default: 50
-	DBPath         string `json:"db_path"`          // SQLite path
-	SocketPath     string `json:"socket_path"`      // Unix socket path
+	MaxMemoryClips int      `json:"max_memory_clips" toml:"max_memory_clips" yaml:"max_memory_clips"` // Default: 50
+	DBPath         string   `json:"db_path" toml:"db_path" yaml:"db_path"`                            // SQLite path
+	SocketPath     string   `json:"socket_path" toml:"socket_path" yaml:"socket_path"`                // Unix socket path
+	StorageBackend string   `json:"storage_backend" toml:"storage_backend" yaml:"storage_backend"`    // "memory", "sqlite" or "tiered"
+	HotClips       int      `json:"hot_clips" toml:"hot_clips" yaml:"hot_clips"`                      // Clips cached in memory by the tiered backend
+	MaxAge         Duration `json:"max_age" toml:"max_age" yaml:"max_age"`                            // Remove unpinned clips older than this, e.g. "72h"; 0 keeps them
+	MaxTotalSize   ByteSize `json:"max_total_size" toml:"max_total_size" yaml:"max_total_size"`       // Byte budget for all clips, e.g. "256MB"; 0 = unlimited
+	MaxClipSize    ByteSize `json:"max_clip_size" toml:"max_clip_size" yaml:"max_clip_size"`          // Largest single clip, e.g. "10MB"; 0 = unlimited
+	OversizePolicy string   `json:"oversize_policy" toml:"oversize_policy" yaml:"oversize_policy"`    // "reject" or "truncate" clips over max_clip_size
+	TrashSize      int      `json:"trash_size" toml:"trash_size" yaml:"trash_size"`                   // Deleted and evicted clips kept for restore; 0 disables the trash
+	Dedup          string   `json:"dedup" toml:"dedup" yaml:"dedup"`                                  // "exact", "whitespace", "case-insensitive" or "consecutive"
+	ProtectTagged  bool     `json:"protect_tagged" toml:"protect_tagged" yaml:"protect_tagged"`       // Keep tagged clips from eviction like pinned ones
+
+	Watcher      string   `json:"watcher" toml:"watcher" yaml:"watcher"`                   // "auto", "poll", "wayland" or "x11"
+	PollInterval Duration `json:"poll_interval" toml:"poll_interval" yaml:"poll_interval"` // Clipboard poll interval, e.g. "500ms"
+
+	PrimarySelection bool `json:"primary_selection" toml:"primary_selection" yaml:"primary_selection"` // Also record the PRIMARY selection (Linux)
+	SelectionSync    bool `json:"selection_sync" toml:"selection_sync" yaml:"selection_sync"`          // Mirror CLIPBOARD and PRIMARY into each other
+
+	IgnorePatterns []string `json:"ignore_patterns" toml:"ignore_patterns" yaml:"ignore_patterns"` // Regexes; matching clips are not stored (same as drop rules)
+	Rules          []Rule   `json:"rules" toml:"rules" yaml:"rules"`                               // What to do with sensitive or unwanted content
+
+	SensitiveClearAfter Duration `json:"sensitive_clear_after" toml:"sensitive_clear_after" yaml:"sensitive_clear_after"` // Clear the clipboard this long after copying a sensitive clip; 0 disables
+	SensitiveRestore    bool     `json:"sensitive_restore" toml:"sensitive_restore" yaml:"sensitive_restore"`             // Put back what was on the clipboard before, instead of clearing it
+}
+
+// Rule decides what happens to captured text that matches it. Each rule sets
+// one matcher: a pattern, a detector, or min_length and/or max_length.
+type Rule struct {
+	Name      string   `json:"name" toml:"name" yaml:"name"`                   // Shown by `clipnest rules test`; defaults to the matcher
+	Pattern   string   `json:"pattern" toml:"pattern" yaml:"pattern"`          // Regex found anywhere in the text
+	Detector  string   `json:"detector" toml:"detector" yaml:"detector"`       // Built-in secret detector, e.g. "aws_key"
+	MinLength int      `json:"min_length" toml:"min_length" yaml:"min_length"` // Matches text shorter than this
+	MaxLength int      `json:"max_length" toml:"max_length" yaml:"max_length"` // Matches text longer than this
+	Action    string   `json:"action" toml:"action" yaml:"action"`             // "drop" (default), "redact", "expire" or "sensitive"
+	TTL       Duration `json:"ttl" toml:"ttl" yaml:"ttl"`                      // How long "expire" keeps the clip, e.g. "10m"
+}
+
+// Duration is a time.Duration written as a string ("500ms", "2s") in config files
+type Duration time.Duration
+
+// UnmarshalText parses a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// ParseDuration is time.ParseDuration that also accepts a leading number of
+// days, e.g. "7d" or "1d12h"
+func ParseDuration(s string) (time.Duration, error) {
+	days, rest, found := strings.Cut(s, "d")
+	if !found {
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.ParseFloat(days, 64)
+	if err != nil || strings.Trim(days, "0123456789.") != "" || n > 100*365 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	d := time.Duration(n * float64(24*time.Hour))
+	if rest == "" {
+		return d, nil
+	}
+	extra, err := time.ParseDuration(rest)
+	if err != nil || extra < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d + extra, nil
+}
+
+// MarshalText formats the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// ByteSize is a number of bytes written as a string ("512KB", "10MB") in config files
+type ByteSize int64
+
+// UnmarshalText parses a size like "1.5MB"
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	parsed, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(parsed)
+	return nil
 }
 
+// MarshalText formats the size as a string
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(FormatByteSize(int64(b))), nil
+}
+
+// byteUnits are the size suffixes ParseByteSize accepts, largest first; KB, MB and GB are binary
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GiB", 1 << 30}, {"GB", 1 << 30}, {"G", 1 << 30},
+	{"MiB", 1 << 20}, {"MB", 1 << 20}, {"M", 1 << 20},
+	{"KiB", 1 << 10}, {"KB", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a byte count with an optional unit, e.g. "4096", "512KB" or "1.5GB"
+func ParseByteSize(s string) (int64, error) {
+	number, unit := strings.TrimSpace(s), int64(1)
+	for _, u := range byteUnits {
+		if len(number) > len(u.suffix) && strings.EqualFold(number[len(number)-len(u.suffix):], u.suffix) {
+			number, unit = strings.TrimSpace(number[:len(number)-len(u.suffix)]), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || strings.Trim(number, "0123456789.") != "" || n*float64(unit) > 1<<50 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatByteSize formats a byte count in the largest unit it reaches, to
+// one decimal, e.g. "1.5MB" or "256MB"
+func FormatByteSize(n int64) string {
+	for _, u := range byteUnits {
+		if len(u.suffix) == 2 && n >= u.size {
+			v := math.Round(float64(n)/float64(u.size)*10) / 10
+			return strconv.FormatFloat(v, 'f', -1, 64) + u.suffix
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// Storage backends
+const (
+	BackendMemory = "memory" // RAM only, lost on restart
+	BackendSQLite = "sqlite" // every read and write hits the database
+	BackendTiered = "tiered" // recent clips in RAM, everything in the database
+)
+
+// Oversize policies for clips over max_clip_size
+const (
+	OversizeReject   = "reject"   // don't store the clip
+	OversizeTruncate = "truncate" // cut text down to max_clip_size; other clips are rejected
+)
+
+// Dedup modes: when a copy counts as a clip already in history
+const (
+	DedupExact           = "exact"            // identical content anywhere in history
+	DedupWhitespace      = "whitespace"       // text differing only in whitespace
+	DedupCaseInsensitive = "case-insensitive" // text differing only in case
+	DedupConsecutive     = "consecutive"      // identical to the most recent clip only
+)
+
+// Clipboard watchers; auto picks wayland, then x11, then poll
+const (
+	WatcherAuto    = "auto"
+	WatcherPoll    = "poll"    // read the clipboard every poll_interval
+	WatcherWayland = "wayland" // wl-paste --watch (wlroots/KDE compositors)
+	WatcherX11     = "x11"     // XFixes selection events
+)
+
+// Rule actions
+const (
+	ActionDrop      = "drop"      // don't store the clip
+	ActionRedact    = "redact"    // store it with the matches replaced
+	ActionExpire    = "expire"    // store it and remove it after the rule's ttl
+	ActionSensitive = "sensitive" // store it marked sensitive, so copying it back clears the clipboard later
+)
+
+// Built-in secret detectors for rules
+const (
+	DetectorAWSKey     = "aws_key"     // AWS access key IDs and secret access key assignments
+	DetectorJWT        = "jwt"         // JSON Web Tokens
+	DetectorPrivateKey = "private_key" // PEM/OpenSSH/PGP private key blocks
+	DetectorCreditCard = "credit_card" // card numbers of major issuers passing the Luhn check
+)
+
 // Default configuration values
 const (
 	DefaultMaxMemoryClips = 50
-	DefaultSocketPath     = "/tmp/clipnest.sock"
+	DefaultSocketPath     = "/tmp/clipnest.sock" // macOS; see defaultSocketPath
+	DefaultHotClips       = 50
+	DefaultPollInterval   = 500 * time.Millisecond
+	DefaultSensitiveClear = 30 * time.Second
+	DefaultTrashSize      = 100
 )
 
+// Environment variables that override file settings
+const (
+	EnvConfig         = "CLIPNEST_CONFIG"
+	EnvSocketPath     = "CLIPNEST_SOCKET_PATH"
+	EnvDBPath         = "CLIPNEST_DB_PATH"
+	EnvMaxClips       = "CLIPNEST_MAX_CLIPS"
+	EnvStorageBackend = "CLIPNEST_STORAGE_BACKEND"
+	EnvHotClips       = "CLIPNEST_HOT_CLIPS"
+	EnvPollInterval   = "CLIPNEST_POLL_INTERVAL"
+	EnvWatcher        = "CLIPNEST_WATCHER"
+	EnvPrimary        = "CLIPNEST_PRIMARY_SELECTION"
+	EnvSelectionSync  = "CLIPNEST_SELECTION_SYNC"
+	EnvSensitiveClear = "CLIPNEST_SENSITIVE_CLEAR_AFTER"
+	EnvMaxAge         = "CLIPNEST_MAX_AGE"
+	EnvMaxTotalSize   = "CLIPNEST_MAX_TOTAL_SIZE"
+	EnvMaxClipSize    = "CLIPNEST_MAX_CLIP_SIZE"
+	EnvOversizePolicy = "CLIPNEST_OVERSIZE_POLICY"
+	EnvTrashSize      = "CLIPNEST_TRASH_SIZE"
+	EnvDedup          = "CLIPNEST_DEDUP"
+	EnvProtectTagged  = "CLIPNEST_PROTECT_TAGGED"
+)
+
+// configNames are the file names looked up in the config directory, in order
+var configNames = []string{"config.json", "config.toml", "config.yaml", "config.yml"}
+
 // DefaultConfig returns default configuration
 func DefaultConfig() Config {
-	homeDir, _ := os.UserHomeDir()
 	return Config{
 		MaxMemoryClips: DefaultMaxMemoryClips,
-		DBPath:         filepath.Join(homeDir, "Library", "Application Support", "ClipNest", "clipnest.db"),
-		SocketPath:     DefaultSocketPath,
+		DBPath:         defaultDBPath(),
+		SocketPath:     defaultSocketPath(),
+		StorageBackend: BackendTiered,
+		HotClips:       DefaultHotClips,
+		Watcher:        WatcherAuto,
+		PollInterval:   Duration(DefaultPollInterval),
+		OversizePolicy: OversizeReject,
+		TrashSize:      DefaultTrashSize,
+		Dedup:          DedupExact,
+
+		SensitiveClearAfter: Duration(DefaultSensitiveClear),
 	}
 }
 
-// Load loads configuration (expand environment variables)
-func Load(path string) (Config, error) {
-	// For now, use defaults
-	// TODO: Load from JSON/YAML file
-	return DefaultConfig(), nil
+// defaultSocketPath returns the per-OS socket location. macOS keeps the
+// shared /tmp path the menu bar app connects to; elsewhere the socket lives in
+// the per-user runtime dir, or a per-user /tmp dir when that is unset.
+func defaultSocketPath() string {
+	if runtime.GOOS == "darwin" {
+		return DefaultSocketPath
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "clipnest", "clipnest.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("clipnest-%d", os.Getuid()), "clipnest.sock")
 }
 
-// GetDBPath returns the database path
-func GetDBPath() string {
-	cfg := DefaultConfig()
-	return cfg.DBPath
+// defaultDBPath returns the per-OS database location:
+// ~/Library/Application Support/ClipNest on macOS, $XDG_DATA_HOME/clipnest elsewhere
+func defaultDBPath() string {
+	homeDir, _ := os.UserHomeDir()
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(homeDir, "Library", "Application Support", "ClipNest", "clipnest.db")
+	}
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		dataDir = filepath.Join(homeDir, ".local", "share")
+	}
+	return filepath.Join(dataDir, "clipnest", "clipnest.db")
 }
 
-// GetSocketPath returns the socket path
-func GetSocketPath() string {
-	cfg := DefaultConfig()
-	return cfg.SocketPath
+// ConfigDir returns the per-user config directory:
+// ~/Library/Application Support/ClipNest on macOS, $XDG_CONFIG_HOME/clipnest elsewhere
+func ConfigDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(dir, "ClipNest")
+	}
+	return filepath.Join(dir, "clipnest")
+}
+
+// DefaultPath returns the config file to load when none is given:
+// $CLIPNEST_CONFIG, else the first existing config.{json,toml,yaml,yml} in ConfigDir,
+// else ConfigDir/config.json
+func DefaultPath() string {
+	if p := os.Getenv(EnvConfig); p != "" {
+		return p
+	}
+
+	dir := ConfigDir()
+	for _, name := range configNames {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return filepath.Join(dir, configNames[0])
 }
 
-// EnsureDirectories creates necessary directories
-func EnsureDirectories() error {
+// Load loads configuration from path (DefaultPath when empty), applies
+// environment overrides and validates the result. A missing file is only an
+// error when it was asked for explicitly.
+func Load(path string) (Config, error) {
 	cfg := DefaultConfig()
+
+	explicit := path != "" || os.Getenv(EnvConfig) != ""
+	if path == "" {
+		path = DefaultPath()
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := decode(path, data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("config %s: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+		// No config file: defaults plus environment
+	default:
+		return Config{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	cfg.DBPath = expandPath(cfg.DBPath)
+	cfg.SocketPath = expandPath(cfg.SocketPath)
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// decode parses data into cfg according to the file extension, rejecting unknown keys
+func decode(path string, data []byte, cfg *Config) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(cfg)
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown key %q", undecoded[0].String())
+		}
+		return nil
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported config format %q (use .json, .toml or .yaml)", ext)
+	}
+}
+
+// applyEnv overrides settings from CLIPNEST_* environment variables
+func applyEnv(cfg *Config) error {
+	if v := os.Getenv(EnvSocketPath); v != "" {
+		cfg.SocketPath = v
+	}
+	if v := os.Getenv(EnvDBPath); v != "" {
+		cfg.DBPath = v
+	}
+	if v := os.Getenv(EnvStorageBackend); v != "" {
+		cfg.StorageBackend = v
+	}
+	if v := os.Getenv(EnvWatcher); v != "" {
+		cfg.Watcher = v
+	}
+	if v := os.Getenv(EnvPollInterval); v != "" {
+		if err := cfg.PollInterval.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("%s: invalid duration %q", EnvPollInterval, v)
+		}
+	}
+	if v := os.Getenv(EnvMaxAge); v != "" {
+		if err := cfg.MaxAge.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("%s: invalid duration %q", EnvMaxAge, v)
+		}
+	}
+	if v := os.Getenv(EnvOversizePolicy); v != "" {
+		cfg.OversizePolicy = v
+	}
+	if v := os.Getenv(EnvDedup); v != "" {
+		cfg.Dedup = v
+	}
+	if err := envSize(EnvMaxTotalSize, &cfg.MaxTotalSize); err != nil {
+		return err
+	}
+	if err := envSize(EnvMaxClipSize, &cfg.MaxClipSize); err != nil {
+		return err
+	}
+	if v := os.Getenv(EnvSensitiveClear); v != "" {
+		if err := cfg.SensitiveClearAfter.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("%s: invalid duration %q", EnvSensitiveClear, v)
+		}
+	}
+	if err := envBool(EnvProtectTagged, &cfg.ProtectTagged); err != nil {
+		return err
+	}
+	if err := envBool(EnvPrimary, &cfg.PrimarySelection); err != nil {
+		return err
+	}
+	if err := envBool(EnvSelectionSync, &cfg.SelectionSync); err != nil {
+		return err
+	}
+	if err := envInt(EnvMaxClips, &cfg.MaxMemoryClips); err != nil {
+		return err
+	}
+	if err := envInt(EnvTrashSize, &cfg.TrashSize); err != nil {
+		return err
+	}
+	return envInt(EnvHotClips, &cfg.HotClips)
+}
+
+// envBool parses a boolean environment variable into dst when set
+func envBool(name string, dst *bool) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s: invalid boolean %q", name, v)
+	}
+	*dst = b
+	return nil
+}
+
+// envSize parses a byte size environment variable into dst when set
+func envSize(name string, dst *ByteSize) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	if err := dst.UnmarshalText([]byte(v)); err != nil {
+		return fmt.Errorf("%s: invalid size %q", name, v)
+	}
+	return nil
+}
+
+// envInt parses an integer environment variable into dst when set
+func envInt(name string, dst *int) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: invalid integer %q", name, v)
+	}
+	*dst = n
+	return nil
+}
+
+// expandPath expands environment variables and a leading ~ in a path
+func expandPath(p string) string {
+	p = os.ExpandEnv(p)
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, p[1:])
+		}
+	}
+	return p
+}
+
+// Validate checks that every setting is usable; errors name the offending key
+func (c Config) Validate() error {
+	if c.MaxMemoryClips <= 0 {
+		return fmt.Errorf("max_memory_clips: must be positive, got %d", c.MaxMemoryClips)
+	}
+	if c.SocketPath == "" {
+		return fmt.Errorf("socket_path: must not be empty")
+	}
+
+	switch c.StorageBackend {
+	case BackendMemory:
+	case BackendSQLite, BackendTiered:
+		if c.DBPath == "" {
+			return fmt.Errorf("db_path: must not be empty for the %s backend", c.StorageBackend)
+		}
+	default:
+		return fmt.Errorf("storage_backend: unknown backend %q (want %s, %s or %s)",
+			c.StorageBackend, BackendMemory, BackendSQLite, BackendTiered)
+	}
+
+	if c.StorageBackend == BackendTiered && c.HotClips <= 0 {
+		return fmt.Errorf("hot_clips: must be positive, got %d", c.HotClips)
+	}
+
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max_age: must not be negative, got %s", time.Duration(c.MaxAge))
+	}
+
+	if c.TrashSize < 0 {
+		return fmt.Errorf("trash_size: must not be negative, got %d", c.TrashSize)
+	}
+
+	if c.MaxTotalSize < 0 {
+		return fmt.Errorf("max_total_size: must not be negative")
+	}
+	if c.MaxClipSize < 0 {
+		return fmt.Errorf("max_clip_size: must not be negative")
+	}
+	if c.MaxTotalSize > 0 && c.MaxClipSize > c.MaxTotalSize {
+		return fmt.Errorf("max_clip_size: must not exceed max_total_size (%s)", FormatByteSize(int64(c.MaxTotalSize)))
+	}
+	switch c.OversizePolicy {
+	case OversizeReject, OversizeTruncate:
+	default:
+		return fmt.Errorf("oversize_policy: unknown policy %q (want %s or %s)",
+			c.OversizePolicy, OversizeReject, OversizeTruncate)
+	}
+	switch c.Dedup {
+	case DedupExact, DedupWhitespace, DedupCaseInsensitive, DedupConsecutive:
+	default:
+		return fmt.Errorf("dedup: unknown mode %q (want %s, %s, %s or %s)",
+			c.Dedup, DedupExact, DedupWhitespace, DedupCaseInsensitive, DedupConsecutive)
+	}
+
+	switch c.Watcher {
+	case WatcherAuto, WatcherPoll, WatcherWayland, WatcherX11:
+	default:
+		return fmt.Errorf("watcher: unknown watcher %q (want %s, %s, %s or %s)",
+			c.Watcher, WatcherAuto, WatcherPoll, WatcherWayland, WatcherX11)
+	}
+
+	if c.SelectionSync && !c.PrimarySelection {
+		return fmt.Errorf("selection_sync: requires primary_selection")
+	}
+
+	if c.PollInterval < Duration(10*time.Millisecond) {
+		return fmt.Errorf("poll_interval: must be at least 10ms, got %s", time.Duration(c.PollInterval))
+	}
+
+	if c.SensitiveClearAfter < 0 {
+		return fmt.Errorf("sensitive_clear_after: must not be negative, got %s", time.Duration(c.SensitiveClearAfter))
+	}
+
+	if _, err := c.CompileIgnorePatterns(); err != nil {
+		return err
+	}
+
+	for i, r := range c.Rules {
+		if err := r.Validate(); errors.Is(err, ErrRuleMatchers) {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		} else if err != nil {
+			return fmt.Errorf("rules[%d].%w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// ErrRuleMatchers is Rule.Validate's error for a rule with no matcher or more
+// than one
+var ErrRuleMatchers = errors.New("set exactly one of pattern, detector or min_length/max_length")
+
+// Validate checks one rule; errors start with the offending key, except
+// ErrRuleMatchers, which is about the rule as a whole
+func (r Rule) Validate() error {
+	matchers := 0
+	if r.Pattern != "" {
+		matchers++
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+	}
+	if r.Detector != "" {
+		matchers++
+		switch r.Detector {
+		case DetectorAWSKey, DetectorJWT, DetectorPrivateKey, DetectorCreditCard:
+		default:
+			return fmt.Errorf("detector: unknown detector %q (want %s, %s, %s or %s)",
+				r.Detector, DetectorAWSKey, DetectorJWT, DetectorPrivateKey, DetectorCreditCard)
+		}
+	}
+	if r.MinLength < 0 {
+		return fmt.Errorf("min_length: must not be negative, got %d", r.MinLength)
+	}
+	if r.MaxLength < 0 {
+		return fmt.Errorf("max_length: must not be negative, got %d", r.MaxLength)
+	}
+	if r.MinLength > 0 || r.MaxLength > 0 {
+		matchers++
+	}
+	if matchers != 1 {
+		return ErrRuleMatchers
+	}
+
+	switch r.Action {
+	case "", ActionDrop, ActionRedact, ActionSensitive:
+	case ActionExpire:
+		if r.TTL <= 0 {
+			return fmt.Errorf("ttl: must be positive for the %s action", ActionExpire)
+		}
+	default:
+		return fmt.Errorf("action: unknown action %q (want %s, %s, %s or %s)",
+			r.Action, ActionDrop, ActionRedact, ActionExpire, ActionSensitive)
+	}
+	return nil
+}
+
+// CompileIgnorePatterns compiles IgnorePatterns; errors name the offending entry
+func (c Config) CompileIgnorePatterns() ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(c.IgnorePatterns))
+	for i, p := range c.IgnorePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("ignore_patterns[%d]: %w", i, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// EnsureDirectories creates necessary directories: the database dir and a
+// private (0700) socket dir
+func EnsureDirectories(cfg Config) error {
+	if err := ensureSocketDir(filepath.Dir(cfg.SocketPath)); err != nil {
+		return err
+	}
+	if cfg.StorageBackend == BackendMemory {
+		return nil
+	}
 	return os.MkdirAll(filepath.Dir(cfg.DBPath), 0755)
 }
+
+// ensureSocketDir creates dir with mode 0700 if missing. An existing dir
+// owned by another user is rejected (they could hijack the socket) unless it
+// is a shared sticky dir such as /tmp; one of ours that others can get into
+// is tightened to 0700.
+func ensureSocketDir(dir string) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create socket dir: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat socket dir: %w", err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("socket dir %s is not a directory", dir)
+	}
+	if info.Mode()&os.ModeSticky != 0 {
+		return nil
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("socket dir %s is owned by another user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return fmt.Errorf("failed to restrict socket dir: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with the given name into a temp dir
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad_Formats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"max_memory_clips": 120, "socket_path": "/tmp/test.sock", "poll_interval": "2s"}`,
+		"config.toml": "max_memory_clips = 120\nsocket_path = \"/tmp/test.sock\"\npoll_interval = \"2s\"\n",
+		"config.yaml": "max_memory_clips: 120\nsocket_path: /tmp/test.sock\npoll_interval: 2s\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, name, content))
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if cfg.MaxMemoryClips != 120 {
+				t.Fatalf("Expected max_memory_clips 120, got %d", cfg.MaxMemoryClips)
+			}
+			if cfg.SocketPath != "/tmp/test.sock" {
+				t.Fatalf("Expected socket_path /tmp/test.sock, got %s", cfg.SocketPath)
+			}
+			if time.Duration(cfg.PollInterval) != 2*time.Second {
+				t.Fatalf("Expected poll_interval 2s, got %s", time.Duration(cfg.PollInterval))
+			}
+			// Unset keys keep their defaults
+			if cfg.StorageBackend != BackendTiered {
+				t.Fatalf("Expected default storage_backend, got %s", cfg.StorageBackend)
+			}
+		})
+	}
+}
+
+func TestLoad_UnknownKeyNamed(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"max_clipz": 10}`,
+		"config.toml": "max_clipz = 10\n",
+		"config.yaml": "max_clipz: 10\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, name, content))
+			if err == nil || !strings.Contains(err.Error(), "max_clipz") {
+				t.Fatalf("Expected error naming max_clipz, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoad_ValidationNamesKey(t *testing.T) {
+	_, err := Load(writeConfig(t, "config.json", `{"max_memory_clips": 0}`))
+	if err == nil || !strings.Contains(err.Error(), "max_memory_clips") {
+		t.Fatalf("Expected error naming max_memory_clips, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"storage_backend": "redis"}`))
+	if err == nil || !strings.Contains(err.Error(), "storage_backend") {
+		t.Fatalf("Expected error naming storage_backend, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"watcher": "inotify"}`))
+	if err == nil || !strings.Contains(err.Error(), "watcher") {
+		t.Fatalf("Expected error naming watcher, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"max_total_size": "1MB", "max_clip_size": "2MB"}`))
+	if err == nil || !strings.Contains(err.Error(), "max_clip_size") {
+		t.Fatalf("Expected error naming max_clip_size, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"oversize_policy": "split"}`))
+	if err == nil || !strings.Contains(err.Error(), "oversize_policy") {
+		t.Fatalf("Expected error naming oversize_policy, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"trash_size": -1}`))
+	if err == nil || !strings.Contains(err.Error(), "trash_size") {
+		t.Fatalf("Expected error naming trash_size, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"dedup": "fuzzy"}`))
+	if err == nil || !strings.Contains(err.Error(), "dedup") {
+		t.Fatalf("Expected error naming dedup, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"max_age": "-1h"}`))
+	if err == nil || !strings.Contains(err.Error(), "max_age") {
+		t.Fatalf("Expected error naming max_age, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"selection_sync": true}`))
+	if err == nil || !strings.Contains(err.Error(), "selection_sync") {
+		t.Fatalf("Expected error naming selection_sync, got %v", err)
+	}
+
+	_, err = Load(writeConfig(t, "config.json", `{"ignore_patterns": ["ok", "(unclosed"]}`))
+	if err == nil || !strings.Contains(err.Error(), "ignore_patterns[1]") {
+		t.Fatalf("Expected error naming ignore_patterns[1], got %v", err)
+	}
+
+	rules := map[string]string{
+		`[{"pattern": "x"}, {"detector": "ssn"}]`:   "rules[1].detector",
+		`[{"pattern": "("}]`:                        "rules[0].pattern",
+		`[{"pattern": "x", "detector": "jwt"}]`:     "rules[0]: set exactly one",
+		`[{"action": "drop"}]`:                      "rules[0]: set exactly one",
+		`[{"detector": "jwt", "action": "expire"}]`: "rules[0].ttl",
+		`[{"detector": "jwt", "action": "shred"}]`:  "rules[0].action",
+		`[{"min_length": -1}]`:                      "rules[0].min_length",
+		`[{"max_length": -1}]`:                      "rules[0].max_length",
+	}
+	for rule, key := range rules {
+		_, err = Load(writeConfig(t, "config.json", `{"rules": `+rule+`}`))
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Fatalf("Expected error naming %s for %s, got %v", key, rule, err)
+		}
+	}
+}
+
+func TestLoad_Rules(t *testing.T) {
+	path := writeConfig(t, "config.toml", `
+[[rules]]
+name = "otp"
+pattern = '^\d{6}$'
+action = "expire"
+ttl = "2m"
+
+[[rules]]
+detector = "aws_key"
+action = "redact"
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.Rules) != 2 || cfg.Rules[0].TTL != Duration(2*time.Minute) || cfg.Rules[1].Detector != DetectorAWSKey {
+		t.Fatalf("Unexpected rules: %+v", cfg.Rules)
+	}
+}
+
+func TestLoad_EnvOverrides(t *testing.T) {
+	path := writeConfig(t, "config.json", `{"max_memory_clips": 120, "socket_path": "/tmp/file.sock"}`)
+	t.Setenv(EnvMaxClips, "7")
+	t.Setenv(EnvSocketPath, "/tmp/env.sock")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.MaxMemoryClips != 7 {
+		t.Fatalf("Expected env max clips 7, got %d", cfg.MaxMemoryClips)
+	}
+	if cfg.SocketPath != "/tmp/env.sock" {
+		t.Fatalf("Expected env socket path, got %s", cfg.SocketPath)
+	}
+
+	t.Setenv(EnvMaxClips, "lots")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), EnvMaxClips) {
+		t.Fatalf("Expected error naming %s, got %v", EnvMaxClips, err)
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	// A missing file in the default location falls back to defaults
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	if _, err := Load(""); err != nil {
+		t.Fatalf("Expected defaults when no config file exists, got %v", err)
+	}
+
+	// An explicitly requested file must exist
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("Expected error for missing explicit config file")
+	}
+}
+
+func TestDefaultConfig_LinuxPaths(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG defaults only apply on Linux")
+	}
+
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	t.Setenv("XDG_DATA_HOME", "/home/test/.data")
+	cfg := DefaultConfig()
+	if cfg.SocketPath != "/run/user/1000/clipnest/clipnest.sock" {
+		t.Fatalf("Unexpected socket path: %s", cfg.SocketPath)
+	}
+	if cfg.DBPath != "/home/test/.data/clipnest/clipnest.db" {
+		t.Fatalf("Unexpected db path: %s", cfg.DBPath)
+	}
+
+	// Without XDG_RUNTIME_DIR the socket falls back to a per-user temp dir
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	want := fmt.Sprintf("clipnest-%d", os.Getuid())
+	if got := filepath.Base(filepath.Dir(DefaultConfig().SocketPath)); got != want {
+		t.Fatalf("Expected socket dir %s, got %s", want, got)
+	}
+}
+
+func TestEnsureDirectories_PrivateSocketDir(t *testing.T) {
+	base := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.SocketPath = filepath.Join(base, "run", "clipnest", "clipnest.sock")
+	cfg.DBPath = filepath.Join(base, "data", "clipnest.db")
+
+	if err := EnsureDirectories(cfg); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Dir(cfg.SocketPath))
+	if err != nil {
+		t.Fatalf("Socket dir not created: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("Expected socket dir mode 0700, got %o", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Dir(cfg.DBPath)); err != nil {
+		t.Fatalf("DB dir not created: %v", err)
+	}
+
+	// An existing dir others can write to is tightened too
+	if err := os.Chmod(filepath.Dir(cfg.SocketPath), 0777); err != nil {
+		t.Fatalf("Failed to loosen socket dir: %v", err)
+	}
+	if err := EnsureDirectories(cfg); err != nil {
+		t.Fatalf("Failed to ensure directories: %v", err)
+	}
+	if info, err = os.Stat(filepath.Dir(cfg.SocketPath)); err != nil {
+		t.Fatalf("Socket dir gone: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("Expected existing socket dir restricted to 0700, got %o", info.Mode().Perm())
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"500ms": 500 * time.Millisecond,
+		"72h":   72 * time.Hour,
+		"7d":    7 * 24 * time.Hour,
+		"1.5d":  36 * time.Hour,
+		"1d12h": 36 * time.Hour,
+	}
+	for s, want := range valid {
+		got, err := ParseDuration(s)
+		if err != nil || got != want {
+			t.Fatalf("ParseDuration(%q) = %s, %v; want %s", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "d", "-1d", "infd", "1d-1h", "1dx", "week"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Fatalf("Expected ParseDuration(%q) to fail", s)
+		}
+	}
+
+	cfg, err := Load(writeConfig(t, "config.json", `{"max_age": "30d"}`))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if time.Duration(cfg.MaxAge) != 30*24*time.Hour {
+		t.Fatalf("Expected max_age 30d, got %s", time.Duration(cfg.MaxAge))
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	valid := map[string]int64{
+		"0":     0,
+		"4096":  4096,
+		"512B":  512,
+		"512KB": 512 << 10,
+		"1.5MB": 3 << 19,
+		"10 mb": 10 << 20,
+		"2GiB":  2 << 30,
+		"64K":   64 << 10,
+	}
+	for s, want := range valid {
+		got, err := ParseByteSize(s)
+		if err != nil || got != want {
+			t.Fatalf("ParseByteSize(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "MB", "-1MB", "1e3", "ten", "1TB"} {
+		if _, err := ParseByteSize(s); err == nil {
+			t.Fatalf("Expected ParseByteSize(%q) to fail", s)
+		}
+	}
+
+	for n, want := range map[int64]string{512: "512B", 1536: "1.5KB", 256 << 20: "256MB", 3 << 29: "1.5GB"} {
+		if got := FormatByteSize(n); got != want {
+			t.Fatalf("FormatByteSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+
+	t.Setenv(EnvMaxClipSize, "2MB")
+	cfg, err := Load(writeConfig(t, "config.yaml", "max_total_size: 256MB\noversize_policy: truncate\n"))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.MaxTotalSize != 256<<20 || cfg.MaxClipSize != 2<<20 || cfg.OversizePolicy != OversizeTruncate {
+		t.Fatalf("Unexpected size settings: %+v", cfg)
+	}
+}
@@ -0,0 +1,127 @@
+package rules
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"clipnest/internal/config"
+)
+
+// detectors implement the built-in secret detectors by name
+var detectors = map[string]func(string) [][]int{
+	config.DetectorAWSKey:     findAWSKeys,
+	config.DetectorJWT:        findAll(jwtPattern),
+	config.DetectorPrivateKey: findAll(privateKeyPattern),
+	config.DetectorCreditCard: findCreditCards,
+}
+
+var (
+	// awsKeyIDPattern matches access key IDs (long-term, temporary and other principal IDs)
+	awsKeyIDPattern = regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)
+
+	// awsSecretPattern matches a secret access key assigned in a config file,
+	// env var or code; group 1 is the key itself
+	awsSecretPattern = regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)
+
+	// jwtPattern matches header.payload.signature where header and payload are base64url JSON objects
+	jwtPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{4,}\.eyJ[A-Za-z0-9_-]{4,}\.[A-Za-z0-9_-]*`)
+
+	// privateKeyPattern matches a private key block; an unterminated block runs to the end of the text
+	privateKeyPattern = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----(?s:.*?)(?:-----END [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----|\z)`)
+
+	// cardCandidatePattern matches 13-19 digits, optionally grouped with spaces or dashes
+	cardCandidatePattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+)
+
+// findAWSKeys reports access key IDs and assigned secret keys
+func findAWSKeys(text string) [][]int {
+	spans := awsKeyIDPattern.FindAllStringIndex(text, -1)
+	for _, m := range awsSecretPattern.FindAllStringSubmatchIndex(text, -1) {
+		spans = append(spans, m[2:4])
+	}
+	return spans
+}
+
+// findCreditCards reports digit runs that start like a card of a known
+// issuer, have its length and pass the Luhn check. The issuer check keeps
+// out IDs and timestamps (13-digit Unix milliseconds start with 1).
+func findCreditCards(text string) [][]int {
+	var spans [][]int
+	for _, m := range cardCandidatePattern.FindAllStringIndex(text, -1) {
+		candidate := text[m[0]:m[1]]
+		if knownIssuer(digitsOf(candidate)) && luhn(candidate) {
+			spans = append(spans, m)
+		}
+	}
+	return spans
+}
+
+// cardIssuer is a range of card number prefixes (IINs) and the lengths its cards have
+type cardIssuer struct {
+	low, high string // prefix range, inclusive, of equal length
+	lengths   []int
+}
+
+// cardIssuers are the major networks' IIN ranges
+var cardIssuers = []cardIssuer{
+	{"4", "4", []int{13, 16, 19}},                 // Visa
+	{"51", "55", []int{16}},                       // Mastercard
+	{"2221", "2720", []int{16}},                   // Mastercard
+	{"34", "34", []int{15}},                       // American Express
+	{"37", "37", []int{15}},                       // American Express
+	{"6011", "6011", []int{16, 17, 18, 19}},       // Discover
+	{"644", "649", []int{16, 17, 18, 19}},         // Discover
+	{"65", "65", []int{16, 17, 18, 19}},           // Discover
+	{"62", "62", []int{16, 17, 18, 19}},           // UnionPay
+	{"3528", "3589", []int{16, 17, 18, 19}},       // JCB
+	{"300", "305", []int{14, 15, 16, 17, 18, 19}}, // Diners Club
+	{"36", "36", []int{14, 15, 16, 17, 18, 19}},   // Diners Club
+	{"38", "39", []int{16, 17, 18, 19}},           // Diners Club
+	{"6304", "6304", []int{16, 17, 18, 19}},       // Maestro
+	{"6759", "6759", []int{16, 17, 18, 19}},       // Maestro
+	{"6761", "6763", []int{16, 17, 18, 19}},       // Maestro
+}
+
+// knownIssuer reports whether digits has the prefix and length of a card issuer
+func knownIssuer(digits string) bool {
+	for _, issuer := range cardIssuers {
+		n := len(issuer.low)
+		if len(digits) >= n && digits[:n] >= issuer.low && digits[:n] <= issuer.high &&
+			slices.Contains(issuer.lengths, len(digits)) {
+			return true
+		}
+	}
+	return false
+}
+
+// digitsOf returns s without its separators
+func digitsOf(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// luhn reports whether the digits in s (separators ignored) pass the Luhn checksum
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,172 @@
+// Package rules decides what happens to captured clipboard text: drop it,
+// store it with secrets redacted, store it with an expiry, or mark it sensitive.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"clipnest/internal/config"
+)
+
+// Redaction replaces each redacted match
+const Redaction = "[redacted]"
+
+// Verdict is the outcome of evaluating text against every rule
+type Verdict struct {
+	Drop      bool          // a drop rule matched; nothing is stored
+	Redacted  bool          // Text has matches replaced by Redaction
+	Text      string        // the text to store
+	TTL       time.Duration // shortest ttl of the matching expire rules; 0 keeps the clip
+	Sensitive bool          // a sensitive rule matched
+	Matched   []string      // names of the matching rules, in config order
+}
+
+// rule is a compiled config.Rule
+type rule struct {
+	name   string
+	action string
+	ttl    time.Duration
+	find   func(text string) [][]int // byte spans of the matches; nil when none
+}
+
+// Engine evaluates captured text against the configured rules
+type Engine struct {
+	rules []rule
+}
+
+// New compiles cfg.Rules; cfg.IgnorePatterns are kept working as drop rules
+func New(cfg config.Config) (*Engine, error) {
+	patterns, err := cfg.CompileIgnorePatterns()
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{}
+	for i, re := range patterns {
+		e.rules = append(e.rules, rule{name: cfg.IgnorePatterns[i], action: config.ActionDrop, find: findAll(re)})
+	}
+
+	for i, r := range cfg.Rules {
+		if err := r.Validate(); errors.Is(err, config.ErrRuleMatchers) {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		} else if err != nil {
+			return nil, fmt.Errorf("rules[%d].%w", i, err)
+		}
+		compiled := rule{name: r.Name, action: r.Action, ttl: time.Duration(r.TTL)}
+		if compiled.action == "" {
+			compiled.action = config.ActionDrop
+		}
+		switch {
+		case r.Pattern != "":
+			compiled.find = findAll(regexp.MustCompile(r.Pattern)) // checked by Validate
+			if compiled.name == "" {
+				compiled.name = r.Pattern
+			}
+		case r.Detector != "":
+			compiled.find = detectors[r.Detector]
+			if compiled.name == "" {
+				compiled.name = r.Detector
+			}
+		default:
+			compiled.find = lengthOutside(r.MinLength, r.MaxLength)
+			if compiled.name == "" {
+				compiled.name = lengthName(r.MinLength, r.MaxLength)
+			}
+		}
+		e.rules = append(e.rules, compiled)
+	}
+	return e, nil
+}
+
+// Len returns the number of rules, including converted ignore patterns
+func (e *Engine) Len() int {
+	return len(e.rules)
+}
+
+// Evaluate applies every rule to text. Any matching drop rule drops it;
+// otherwise all redact matches are replaced and the shortest expire ttl applies.
+func (e *Engine) Evaluate(text string) Verdict {
+	v := Verdict{Text: text}
+	var spans [][]int
+	for _, r := range e.rules {
+		found := r.find(text)
+		if len(found) == 0 {
+			continue
+		}
+		v.Matched = append(v.Matched, r.name)
+		switch r.action {
+		case config.ActionDrop:
+			v.Drop = true
+		case config.ActionRedact:
+			spans = append(spans, found...)
+		case config.ActionExpire:
+			if v.TTL == 0 || r.ttl < v.TTL {
+				v.TTL = r.ttl
+			}
+		case config.ActionSensitive:
+			v.Sensitive = true
+		}
+	}
+
+	if !v.Drop && len(spans) > 0 {
+		v.Text = redact(text, spans)
+		v.Redacted = true
+	}
+	return v
+}
+
+// redact replaces the (possibly overlapping) spans of text with Redaction
+func redact(text string, spans [][]int) string {
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+
+	var b strings.Builder
+	pos := 0
+	for i := 0; i < len(spans); {
+		start, end := spans[i][0], spans[i][1]
+		// Merge every span that overlaps this one
+		for i++; i < len(spans) && spans[i][0] < end; i++ {
+			end = max(end, spans[i][1])
+		}
+		b.WriteString(text[pos:start])
+		b.WriteString(Redaction)
+		pos = end
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+// findAll returns a matcher reporting every match of re
+func findAll(re *regexp.Regexp) func(string) [][]int {
+	return func(text string) [][]int {
+		return re.FindAllStringIndex(text, -1)
+	}
+}
+
+// lengthOutside matches the whole text when it has fewer than min or more
+// than max characters (0 disables either bound)
+func lengthOutside(min, max int) func(string) [][]int {
+	return func(text string) [][]int {
+		n := utf8.RuneCountInString(text)
+		if (min > 0 && n < min) || (max > 0 && n > max) {
+			return [][]int{{0, len(text)}}
+		}
+		return nil
+	}
+}
+
+// lengthName describes a length rule, e.g. "length<3" or "length>1000"
+func lengthName(min, max int) string {
+	var parts []string
+	if min > 0 {
+		parts = append(parts, fmt.Sprintf("length<%d", min))
+	}
+	if max > 0 {
+		parts = append(parts, fmt.Sprintf("length>%d", max))
+	}
+	return strings.Join(parts, ",")
+}
@@ -13,7 +13,8 @@ import (
 type Server struct {
 	listener  net.Listener
 	clients   map[net.Conn]bool
-	mu        sync.RWMutex
+	closed    bool
+	mu        sync.RWMutex // guards clients and closed
 	onCommand func(conn net.Conn, msg SocketMessage)
 }
 
@@ -50,7 +51,10 @@ func (s *Server) accept() {
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
-			if s.listener != nil {
+			s.mu.RLock()
+			closed := s.closed
+			s.mu.RUnlock()
+			if !closed {
 				fmt.Printf("Error accepting connection: %v\n", err)
 			}
 			return
@@ -140,12 +144,14 @@ func SendMessage(conn net.Conn, msg SocketMessage) error {
 
 // Close shuts down the server
 func (s *Server) Close() error {
-	if s.listener != nil {
-		err := s.listener.Close()
-		s.listener = nil
-		return err
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
 	}
-	return nil
+	s.closed = true
+	s.mu.Unlock()
+	return s.listener.Close()
 }
 
 // ClientCount returns the number of connected clients
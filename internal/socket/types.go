@@ -13,6 +13,137 @@ type ClipData struct {
 	Type      string `json:"type"`
 	Timestamp int64  `json:"timestamp"`
 	Pinned    bool   `json:"pinned"`
+	Sensitive bool   `json:"sensitive,omitempty"` // copy_clip clears it from the clipboard again after a while
+
+	// Image clips: dimensions and a base64 PNG thumbnail (fetch the full image with get_image)
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Thumbnail []byte `json:"thumbnail,omitempty"`
+
+	// Source is the selection the clip was captured from ("clipboard" or "primary")
+	Source string `json:"source,omitempty"`
+
+	// Formats lists the extra MIME representations available via get_format
+	Formats []string `json:"formats,omitempty"`
+
+	// Files lists the copied files of a "files" clip
+	Files []FileData `json:"files,omitempty"`
+
+	// ExpiresAt is when a rule will remove the clip (Unix seconds; 0 = never)
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+
+	// Captures counts how often the clip was copied on the system, the first
+	// time included; LastCopied is when a repeat last was (Unix seconds; 0 =
+	// never). Copies counts copy_clip requests for it, LastUsed is when the
+	// last one was. Frecency blends them into a score that halves every week
+	// the clip goes unused.
+	Captures   int     `json:"captures"`
+	LastCopied int64   `json:"last_copied,omitempty"`
+	Copies     int     `json:"copies,omitempty"`
+	LastUsed   int64   `json:"last_used,omitempty"`
+	Frecency   float64 `json:"frecency"`
+
+	// Tags are the sorted, lower-case names the clip is filed under
+	Tags []string `json:"tags,omitempty"`
+
+	// MatchPositions are, in search results, the indexes of the characters
+	// (Unicode code points, not bytes) of Content that matched the query
+	MatchPositions []int `json:"match_positions,omitempty"`
+}
+
+// FileData is one file of a "files" clip, as found when it was copied
+type FileData struct {
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	Size   int64  `json:"size"`
+}
+
+// FormatData is the response payload for get_format
+type FormatData struct {
+	ID   int64  `json:"id"`
+	MIME string `json:"mime"`
+	Data []byte `json:"data"` // base64
+}
+
+// CopyClipData is the response payload for copy_clip
+type CopyClipData struct {
+	ID      int64 `json:"id"`
+	ClearAt int64 `json:"clear_at,omitempty"` // Unix seconds when a sensitive clip is cleared again; 0 = never
+}
+
+// CancelClearData is the response payload for cancel_clear
+type CancelClearData struct {
+	Canceled int `json:"canceled"` // scheduled clears dropped
+}
+
+// ImageData is the response payload for get_image
+type ImageData struct {
+	ID     int64  `json:"id"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Data   []byte `json:"data"` // base64 PNG
+}
+
+// ConfigData is the payload of the config_reloaded broadcast
+type ConfigData struct {
+	MaxClips       int   `json:"max_clips"`
+	PollIntervalMS int64 `json:"poll_interval_ms"`
+	IgnorePatterns int   `json:"ignore_patterns"`
+	Rules          int   `json:"rules"`
+}
+
+// StatsData is the response payload for stats
+type StatsData struct {
+	Clips       int   `json:"clips"`
+	Pinned      int   `json:"pinned"`
+	Bytes       int64 `json:"bytes"`
+	MaxClips    int   `json:"max_clips"`
+	MaxBytes    int64 `json:"max_bytes"`     // 0 = unlimited
+	MaxClipSize int64 `json:"max_clip_size"` // 0 = unlimited
+}
+
+// ClipRemovedData is the payload of the clip_removed broadcast
+type ClipRemovedData struct {
+	IDs    []int64 `json:"ids"`
+	Reason string  `json:"reason"` // why the clips went away: "expired", "deleted" or "cleared"
+}
+
+// TrashedClipData is a clip in the trash, with why and when it was removed
+type TrashedClipData struct {
+	ClipData
+	Reason    string `json:"reason"`     // "deleted", "cleared" or "evicted"
+	RemovedAt int64  `json:"removed_at"` // Unix seconds
+}
+
+// TrashListData is the response payload for trash
+type TrashListData struct {
+	Clips []TrashedClipData `json:"clips"`
+	Count int               `json:"count"`
+}
+
+// QueryErrorData is the data of a failed search response when the query
+// could not be parsed
+type QueryErrorData struct {
+	Pos     int    `json:"pos"`             // byte offset in the query
+	Token   string `json:"token,omitempty"` // the offending part of the query
+	Message string `json:"message"`
+}
+
+// CaptureStatusData is the payload of the capture_status broadcast and the
+// response to pause, resume and capture_status
+type CaptureStatusData struct {
+	Paused bool  `json:"paused"`
+	Until  int64 `json:"until,omitempty"` // Unix seconds when capture resumes by itself; 0 = until resumed
+}
+
+// RulesTestData is the response payload for test_rules
+type RulesTestData struct {
+	Drop       bool     `json:"drop"`
+	Redacted   bool     `json:"redacted"`
+	Text       string   `json:"text"`                  // the text as it would be stored
+	TTLSeconds int64    `json:"ttl_seconds,omitempty"` // set when an expire rule matched
+	Sensitive  bool     `json:"sensitive,omitempty"`   // a sensitive rule matched
+	Matched    []string `json:"matched,omitempty"`     // names of the matching rules
 }
 
 // CommandData represents a command from the client
@@ -22,9 +153,33 @@ type CommandData struct {
 
 // CopyClipCommand sends a clip to clipboard
 type CopyClipCommand struct {
+	ID      int64 `json:"id"`
+	Primary bool  `json:"primary,omitempty"` // write the X11 PRIMARY selection instead
+}
+
+// SetSensitiveCommand marks a clip sensitive, or unmarks it with Sensitive false
+type SetSensitiveCommand struct {
+	ID        int64 `json:"id"`
+	Sensitive bool  `json:"sensitive"`
+}
+
+// ExpireCommand gives a clip a time to live; TTLMS 0 removes it
+type ExpireCommand struct {
+	ID    int64 `json:"id"`
+	TTLMS int64 `json:"ttl_ms"`
+}
+
+// GetImageCommand fetches the full PNG of an image clip
+type GetImageCommand struct {
 	ID int64 `json:"id"`
 }
 
+// GetFormatCommand fetches one MIME representation of a clip ("text/plain" when empty)
+type GetFormatCommand struct {
+	ID   int64  `json:"id"`
+	MIME string `json:"mime"`
+}
+
 // PinCommand pins a clip
 type PinCommand struct {
 	ID int64 `json:"id"`
@@ -35,15 +190,64 @@ type UnpinCommand struct {
 	ID int64 `json:"id"`
 }
 
+// DeleteCommand removes the clip ID, the clips IDs, or every clip matching Query
+type DeleteCommand struct {
+	ID    int64   `json:"id,omitempty"`
+	IDs   []int64 `json:"ids,omitempty"`
+	Query string  `json:"query,omitempty"`
+}
+
+// TagCommand adds tags to a clip, or with untag removes them (all of them
+// if Tags is empty)
+type TagCommand struct {
+	ID   int64    `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+// TagData is a tag in use and how many clips carry it
+type TagData struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TagListData is the response payload for tags
+type TagListData struct {
+	Tags  []TagData `json:"tags"`
+	Count int       `json:"count"`
+}
+
+// RestoreCommand brings a clip back from the trash
+type RestoreCommand struct {
+	ID int64 `json:"id"`
+}
+
+// ClearCommand removes all clips, or only the unpinned ones with KeepPinned
+type ClearCommand struct {
+	KeepPinned bool `json:"keep_pinned,omitempty"`
+}
+
+// PauseCommand stops recording clips, for DurationMS if set
+type PauseCommand struct {
+	DurationMS int64 `json:"duration_ms,omitempty"`
+}
+
+// TestRulesCommand evaluates the ignore rules against text without storing it
+type TestRulesCommand struct {
+	Text string `json:"text"`
+}
+
 // SearchCommand searches clips
 type SearchCommand struct {
 	Query string `json:"query"`
 	Limit int    `json:"limit"`
+	Sort  string `json:"sort,omitempty"` // "relevance" (default), "recent", "frecency" or "pinned-first"
 }
 
 // ListCommand lists clips
 type ListCommand struct {
-	Limit int `json:"limit"`
+	Limit int    `json:"limit"`
+	Sort  string `json:"sort,omitempty"` // "recent" (default), "frecency" or "pinned-first"
+	Tag   string `json:"tag,omitempty"`  // only clips with this tag
 }
 
 // ResponseMessage wraps all daemon responses
@@ -0,0 +1,49 @@
+package storage
+
+// Backend is the clip store that Storage is composed over.
+// Storage layers pinning, eviction and search on top; a backend only has to
+// keep clips in recency order (most recent first), deduplicate on Add by
+// content and type, and be safe for concurrent use.
+type Backend interface {
+	// Add stores a clip and returns its ID. A duplicate moves the existing
+	// clip to the front and returns its ID. A non-zero clip.ID is kept.
+	Add(clip Clip) (int64, error)
+	// Get retrieves a clip by ID
+	Get(id int64) (Clip, bool)
+	// List returns up to limit clips, most recent first
+	List(limit int) []Clip
+	// Update writes a modified clip back by ID without changing its recency
+	Update(clip Clip) bool
+	// Remove deletes a clip by ID
+	Remove(id int64) bool
+	// EvictOldest removes the least recent unpinned (and, if protected,
+	// untagged) clip and returns it
+	EvictOldest() (Clip, bool)
+	// Count returns the number of stored clips
+	Count() int
+	// Bytes returns the total Size of the stored clips
+	Bytes() int64
+	// Clear removes all clips and resets ID assignment
+	Clear()
+	// Each calls fn for every clip, most recent first, until fn returns false.
+	// fn must not call back into the backend.
+	Each(fn func(Clip) bool)
+}
+
+// errReporter is implemented by backends whose bool-returning methods can
+// fail (e.g. on I/O); Err returns the most recent failure and resets it
+type errReporter interface {
+	Err() error
+}
+
+// dedupSwitch is implemented by backends whose Add deduplication can be
+// turned off, so that the same content can be stored more than once
+type dedupSwitch interface {
+	SetDedup(enabled bool)
+}
+
+// evictionGuard is implemented by backends that can keep tagged clips from
+// eviction like pinned ones
+type evictionGuard interface {
+	SetProtectTagged(protect bool)
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"time"
+)
+
+// DedupMode decides when a new clip counts as a copy of a stored one
+type DedupMode string
+
+const (
+	DedupExact           DedupMode = "exact"            // identical content, anywhere in history
+	DedupWhitespace      DedupMode = "whitespace"       // text equal once runs of whitespace are collapsed and trimmed
+	DedupCaseInsensitive DedupMode = "case-insensitive" // text equal ignoring case
+	DedupConsecutive     DedupMode = "consecutive"      // identical to the most recent clip only
+)
+
+// SetDedupMode changes how new clips are deduplicated. Clips already stored
+// are left as they are.
+func (s *Storage) SetDedupMode(mode DedupMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch mode {
+	case DedupExact, DedupWhitespace, DedupCaseInsensitive, DedupConsecutive:
+	default:
+		return fmt.Errorf("unknown dedup mode %q", mode)
+	}
+
+	// Consecutive mode keeps repeats from further back as clips of their own
+	sw, ok := s.backend.(dedupSwitch)
+	if !ok && mode == DedupConsecutive {
+		return fmt.Errorf("dedup mode %q: backend always deduplicates", mode)
+	}
+	if ok {
+		sw.SetDedup(mode != DedupConsecutive)
+	}
+	s.dedup = mode
+	return nil
+}
+
+// duplicateOf finds a stored clip the backend wouldn't itself recognize as
+// a copy of clip under the dedup mode
+func (s *Storage) duplicateOf(clip Clip) (Clip, bool) {
+	switch s.dedup {
+	case DedupConsecutive:
+		if recent := s.backend.List(1); len(recent) == 1 && sameContent(recent[0], clip) {
+			return recent[0], true
+		}
+	case DedupWhitespace, DedupCaseInsensitive:
+		if clip.Type != "text" {
+			break
+		}
+		for _, id := range s.index.similar(clip.Content) {
+			stored, ok := s.backend.Get(id)
+			if ok && stored.Type == clip.Type && s.sameText(stored.Content, clip.Content) {
+				return stored, true
+			}
+		}
+	}
+	return Clip{}, false
+}
+
+// sameText compares two texts as the dedup mode does
+func (s *Storage) sameText(a, b string) bool {
+	switch s.dedup {
+	case DedupWhitespace:
+		return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+	case DedupCaseInsensitive:
+		return strings.ToLower(a) == strings.ToLower(b)
+	}
+	return a == b
+}
+
+// recordHit notes that the clip with id was copied again at copiedAt
+func (s *Storage) recordHit(id int64, copiedAt time.Time) {
+	clip, ok := s.backend.Get(id)
+	if !ok {
+		return
+	}
+	if copiedAt.IsZero() {
+		copiedAt = time.Now()
+	}
+	clip.Hits++
+	clip.LastCopied = copiedAt
+	s.update(clip)
+}
+
+// similarKey hashes text lowercased with its whitespace collapsed, so texts
+// equal under any of the dedup modes share a key
+func similarKey(text string) uint64 {
+	h := fnv.New64a()
+	for i, word := range strings.Fields(text) {
+		if i > 0 {
+			h.Write([]byte{' '})
+		}
+		io.WriteString(h, strings.ToLower(word))
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scores of the fuzzy matcher, modelled on fzf: every matched character
+// earns scoreMatch plus a bonus for where it sits, and gaps between matched
+// characters cost a little
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	bonusBoundaryWhite = 10 // at the start of the text or after whitespace
+	bonusBoundary      = 8  // after punctuation such as / _ - .
+	bonusCamel         = 7  // lower-to-upper or letter-to-digit transition
+	bonusConsecutive   = 4  // right after the previous matched character
+	bonusFirstChar     = 2  // multiplier for the bonus of a term's first character
+)
+
+// Ranking blends match quality with recency and pin status
+const (
+	rankPinned        = 24 // added for pinned clips
+	rankRecent        = 32 // added for the most recent clip, fading with age
+	rankRecentHalfAge = 10 // clips back in history at which the recency bonus has halved
+)
+
+// Match is a clip found by Search
+type Match struct {
+	Clip
+	Score     int   // match quality blended with recency and pin status; higher is better
+	Positions []int // indexes of the matched characters (runes) in Content
+
+	age int // clips added since this one, which breaks ties in Score
+}
+
+// fuzzyTerm is one word of a query, matched as a subsequence. It is
+// smart-case: case-sensitive only if it contains an upper-case letter.
+type fuzzyTerm struct {
+	runes         []rune
+	caseSensitive bool
+}
+
+// newFuzzyTerm makes a smart-case term of word
+func newFuzzyTerm(word string) fuzzyTerm {
+	term := fuzzyTerm{caseSensitive: strings.IndexFunc(word, unicode.IsUpper) >= 0}
+	if !term.caseSensitive {
+		word = strings.ToLower(word)
+	}
+	term.runes = []rune(word)
+	return term
+}
+
+// scoreTerms sums the scores of the terms that match text and, if positions
+// is set, returns the sorted union of their matched positions
+func scoreTerms(terms []fuzzyTerm, text []rune, positions bool) (int, []int) {
+	total := 0
+	var matched []int
+	for _, term := range terms {
+		if score, pos, ok := term.find(text, positions); ok {
+			total += score
+			matched = append(matched, pos...)
+		}
+	}
+	if len(terms) > 1 {
+		matched = uniqueSorted(matched)
+	}
+	return total, matched
+}
+
+// match finds the term in text as a subsequence. Like fzf's v1 algorithm it
+// finds the first occurrence scanning forward, narrows it to the shortest
+// span ending there scanning backward, then scores that span.
+func (t fuzzyTerm) match(text []rune) (int, []int, bool) {
+	return t.find(text, true)
+}
+
+// contains reports whether text has the term as a subsequence, without
+// scoring it
+func (t fuzzyTerm) contains(text []rune) bool {
+	return len(t.runes) == 0 || t.end(text) >= 0
+}
+
+// end returns where the first occurrence of the term in text ends, or -1
+func (t fuzzyTerm) end(text []rune) int {
+	if len(t.runes) == 0 {
+		return -1
+	}
+	for i, p := 0, 0; i < len(text); i++ {
+		if t.equal(text[i], t.runes[p]) {
+			p++
+			if p == len(t.runes) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// find is match, recording the matched positions only if positions is set
+func (t fuzzyTerm) find(text []rune, positions bool) (int, []int, bool) {
+	pattern := t.runes
+	if len(pattern) == 0 {
+		return 0, nil, true
+	}
+
+	end := t.end(text)
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	start := end
+	for i, p := end, len(pattern)-1; i >= 0; i-- {
+		if t.equal(text[i], pattern[p]) {
+			p--
+			if p < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	score := 0
+	var matched []int
+	if positions {
+		matched = make([]int, 0, len(pattern))
+	}
+	consecutive, inGap := false, false
+	for i, p := start, 0; i <= end; i++ {
+		if p < len(pattern) && t.equal(text[i], pattern[p]) {
+			bonus := bonusAt(text, i)
+			if consecutive && bonus < bonusConsecutive {
+				bonus = bonusConsecutive
+			}
+			if p == 0 {
+				bonus *= bonusFirstChar
+			}
+			score += scoreMatch + bonus
+			if positions {
+				matched = append(matched, i)
+			}
+			p++
+			consecutive, inGap = true, false
+			continue
+		}
+		if inGap {
+			score += scoreGapExtension
+		} else {
+			score += scoreGapStart
+		}
+		consecutive, inGap = false, true
+	}
+	return score, matched, true
+}
+
+// equal compares a text character with a pattern character, folding the
+// text's case unless the term is case-sensitive
+func (t fuzzyTerm) equal(r, p rune) bool {
+	if t.caseSensitive {
+		return r == p
+	}
+	return unicode.ToLower(r) == p
+}
+
+// bonusAt rewards matching text[i] by how much it starts a word
+func bonusAt(text []rune, i int) int {
+	if i == 0 || unicode.IsSpace(text[i-1]) {
+		return bonusBoundaryWhite
+	}
+	prev, cur := text[i-1], text[i]
+	switch {
+	case !isWordRune(prev) && isWordRune(cur):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(cur),
+		unicode.IsLetter(prev) && unicode.IsDigit(cur):
+		return bonusCamel
+	}
+	return 0
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// rank blends a match score with the clip's place in history (0 = most
+// recent) and its pin status
+func rank(score, age int, pinned bool) int {
+	score += rankRecent * rankRecentHalfAge / (rankRecentHalfAge + age)
+	if pinned {
+		score += rankPinned
+	}
+	return score
+}
+
+// uniqueSorted sorts positions and drops duplicates
+func uniqueSorted(positions []int) []int {
+	sort.Ints(positions)
+	out := positions[:0]
+	for _, p := range positions {
+		if len(out) == 0 || p != out[len(out)-1] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
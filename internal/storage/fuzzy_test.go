@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyTerm_Match(t *testing.T) {
+	tests := []struct {
+		word      string
+		text      string
+		ok        bool
+		positions []int
+	}{
+		{"abc", "a_b_c", true, []int{0, 2, 4}},
+		{"abc", "acb", false, nil},
+		{"api", "my API key", true, []int{3, 4, 5}}, // lower-case ignores case
+		{"API", "my api key", false, nil},           // upper-case makes it case-sensitive
+		{"Api", "Api", true, []int{0, 1, 2}},
+		{"é", "café", true, []int{3}}, // positions count characters, not bytes
+		// The shortest span ending at the first full match is scored
+		{"ab", "a a ab", true, []int{4, 5}},
+	}
+	for _, tt := range tests {
+		_, positions, ok := newFuzzyTerm(tt.word).match([]rune(tt.text))
+		if ok != tt.ok || !reflect.DeepEqual(positions, tt.positions) {
+			t.Errorf("match(%q, %q) = %v, %v; want %v, %v", tt.word, tt.text, positions, ok, tt.positions, tt.ok)
+		}
+	}
+}
+
+func TestFuzzyTerm_Score(t *testing.T) {
+	score := func(word, text string) int {
+		s, _, ok := newFuzzyTerm(word).match([]rune(text))
+		if !ok {
+			t.Fatalf("Expected %q to match %q", word, text)
+		}
+		return s
+	}
+
+	// Word starts beat the middle of a word, and tight matches beat spread ones
+	if a, b := score("api", "api_key"), score("api", "capital"); a <= b {
+		t.Errorf("Expected a word-start match to score higher: %d <= %d", a, b)
+	}
+	if a, b := score("gc", "git commit"), score("gc", "magic"); a <= b {
+		t.Errorf("Expected word boundaries to score higher: %d <= %d", a, b)
+	}
+	if a, b := score("abc", "abc"), score("abc", "a-x-b-x-c"); a <= b {
+		t.Errorf("Expected a consecutive match to score higher: %d <= %d", a, b)
+	}
+	if a, b := score("fb", "fooBar"), score("fb", "foobar"); a <= b {
+		t.Errorf("Expected a camelCase boundary to score higher: %d <= %d", a, b)
+	}
+}
@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sort"
+	"unicode"
+)
+
+// maxIndexedContent is the most content indexed per clip; longer clips are
+// candidates for every search and matched directly
+const maxIndexedContent = 64 << 10
+
+// compactAfter is how many removed clips the index tolerates before it is
+// rebuilt, provided they also outnumber the live ones
+const compactAfter = 1024
+
+// gram is an index key: a single character, or three consecutive ones
+type gram uint64
+
+func unigram(r rune) gram { return gram(r) }
+
+func trigram(a, b, c rune) gram { return 1<<63 | gram(a)<<42 | gram(b)<<21 | gram(c) }
+
+// indexDoc is a clip as the index knows it, by doc number
+type indexDoc struct {
+	id   int64
+	seq  int64  // recency: higher is more recent
+	hash uint64 // of the indexed content, to notice content changes
+	live bool
+	text bool // a text clip, listed under its similarKey
+	key  uint64
+}
+
+// index is an inverted index of clip contents: for every character and every
+// three consecutive characters (lowercased), the clips containing them. It
+// narrows a search to candidate clips that are then matched for real, so it
+// only ever has to over-approximate. It also tracks recency, pins and text
+// clips by similarKey so none of them needs a scan of the backend.
+//
+// Doc numbers only grow; removing a clip marks its doc dead and compaction
+// drops dead docs once they dominate. Callers serialize access (Storage.mu).
+type index struct {
+	postings  map[gram][]uint32 // ascending doc numbers
+	docs      []indexDoc
+	byID      map[int64]uint32
+	unindexed map[uint32]bool // live docs too long to index
+	pinned    map[int64]bool
+	similars  map[uint64][]int64 // text clip IDs by similarKey
+	seq       int64
+	dead      int
+	scratch   map[gram]struct{}
+}
+
+func newIndex() *index {
+	return &index{
+		postings:  make(map[gram][]uint32),
+		byID:      make(map[int64]uint32),
+		unindexed: make(map[uint32]bool),
+		pinned:    make(map[int64]bool),
+		similars:  make(map[uint64][]int64),
+		scratch:   make(map[gram]struct{}),
+	}
+}
+
+// buildIndex indexes every clip of backend, keeping the recency of the clips
+// old already knew (nil for none)
+func buildIndex(backend Backend, old *index) *index {
+	ix := newIndex()
+	// Keep only what insert reads, not image data and other formats
+	var clips []Clip
+	backend.Each(func(clip Clip) bool {
+		clips = append(clips, Clip{ID: clip.ID, Type: clip.Type, Content: clip.Content, Pinned: clip.Pinned})
+		return true
+	})
+	if old != nil {
+		ix.seq = old.seq
+	} else {
+		ix.seq = int64(len(clips))
+	}
+	// Oldest first, so doc numbers follow history order
+	for i := len(clips) - 1; i >= 0; i-- {
+		seq := int64(len(clips) - i)
+		if old != nil {
+			if n, ok := old.byID[clips[i].ID]; ok {
+				seq = old.docs[n].seq
+			}
+		}
+		ix.insert(clips[i], seq)
+	}
+	return ix
+}
+
+// touch records that clip was just added, or that the clip with its ID was
+// moved to the front as a duplicate
+func (ix *index) touch(clip Clip) {
+	ix.seq++
+	if n, ok := ix.byID[clip.ID]; ok {
+		ix.docs[n].seq = ix.seq
+		return
+	}
+	ix.insert(clip, ix.seq)
+}
+
+// update notes changes to a known clip, re-indexing it if its content changed
+func (ix *index) update(clip Clip) {
+	n, ok := ix.byID[clip.ID]
+	if !ok {
+		return
+	}
+	ix.setPinned(clip)
+	if contentHash(clip.Content) != ix.docs[n].hash {
+		seq := ix.docs[n].seq
+		ix.remove(clip.ID)
+		ix.insert(clip, seq)
+	}
+}
+
+// remove forgets a clip
+func (ix *index) remove(id int64) {
+	n, ok := ix.byID[id]
+	if !ok {
+		return
+	}
+	ix.docs[n].live = false
+	delete(ix.byID, id)
+	delete(ix.unindexed, n)
+	delete(ix.pinned, id)
+	if doc := ix.docs[n]; doc.text {
+		ids := ix.similars[doc.key]
+		for i := range ids {
+			if ids[i] == id {
+				ids = append(ids[:i], ids[i+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(ix.similars, doc.key)
+		} else {
+			ix.similars[doc.key] = ids
+		}
+	}
+	ix.dead++
+}
+
+// has reports whether the clip with id is indexed
+func (ix *index) has(id int64) bool {
+	_, ok := ix.byID[id]
+	return ok
+}
+
+// similar returns the text clips that may equal text under a dedup mode
+func (ix *index) similar(text string) []int64 {
+	return ix.similars[similarKey(text)]
+}
+
+// needsCompaction reports whether dead docs take up more than live ones
+func (ix *index) needsCompaction() bool {
+	return ix.dead > compactAfter && ix.dead > len(ix.byID)
+}
+
+func (ix *index) insert(clip Clip, seq int64) {
+	n := uint32(len(ix.docs))
+	doc := indexDoc{id: clip.ID, seq: seq, hash: contentHash(clip.Content), live: true, text: clip.Type == "text"}
+	if doc.text {
+		doc.key = similarKey(clip.Content)
+		ix.similars[doc.key] = append(ix.similars[doc.key], clip.ID)
+	}
+	ix.docs = append(ix.docs, doc)
+	ix.byID[clip.ID] = n
+	ix.setPinned(clip)
+
+	if len(clip.Content) > maxIndexedContent {
+		ix.unindexed[n] = true
+		return
+	}
+	clear(ix.scratch)
+	addGrams(ix.scratch, []rune(clip.Content))
+	for g := range ix.scratch {
+		ix.postings[g] = append(ix.postings[g], n)
+	}
+}
+
+func (ix *index) setPinned(clip Clip) {
+	if clip.Pinned {
+		ix.pinned[clip.ID] = true
+	} else {
+		delete(ix.pinned, clip.ID)
+	}
+}
+
+// age returns how many clips were added or touched since id was
+func (ix *index) age(id int64) int {
+	if n, ok := ix.byID[id]; ok {
+		return int(ix.seq - ix.docs[n].seq)
+	}
+	return 0
+}
+
+// pinnedIDs returns the pinned clips, most recent first
+func (ix *index) pinnedIDs() []int64 {
+	ids := make([]int64, 0, len(ix.pinned))
+	for id := range ix.pinned {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ix.age(ids[i]) < ix.age(ids[j]) })
+	return ids
+}
+
+// candidates returns the IDs of the live clips that may match node, or false
+// if the index cannot narrow it down and every clip has to be checked. With
+// verbatim, only clips containing each word as it is are candidates, which
+// the word's trigrams narrow down far better than its characters.
+func (ix *index) candidates(node queryNode, verbatim bool) ([]int64, bool) {
+	docs, ok := ix.lookup(node, verbatim)
+	if !ok {
+		return nil, false
+	}
+	ids := make([]int64, 0, len(docs))
+	for _, n := range docs {
+		if ix.docs[n].live {
+			ids = append(ids, ix.docs[n].id)
+		}
+	}
+	return ids, true
+}
+
+// lookup returns the doc numbers that may match node, ascending
+func (ix *index) lookup(node queryNode, verbatim bool) ([]uint32, bool) {
+	switch n := node.(type) {
+	case andNode:
+		var docs []uint32
+		narrowed := false
+		for _, child := range n {
+			if found, ok := ix.lookup(child, verbatim); ok {
+				if narrowed {
+					docs = intersect(docs, found)
+				} else {
+					docs, narrowed = found, true
+				}
+			}
+		}
+		return docs, narrowed
+	case orNode:
+		var docs []uint32
+		for _, child := range n {
+			found, ok := ix.lookup(child, verbatim)
+			if !ok {
+				return nil, false
+			}
+			docs = union(docs, found)
+		}
+		return docs, true
+	case wordNode:
+		if verbatim {
+			return ix.substring(string(n.term.runes))
+		}
+		// A fuzzy match needs every character of the word, in any order
+		grams := make(map[gram]struct{})
+		for _, r := range n.term.runes {
+			grams[unigram(unicode.ToLower(r))] = struct{}{}
+		}
+		return ix.withGrams(grams), len(grams) > 0
+	case phraseNode:
+		return ix.substring(n.text)
+	case regexNode:
+		// Any match starts with the literal prefix, if the pattern has one
+		prefix, _ := n.re.LiteralPrefix()
+		return ix.substring(prefix)
+	}
+	return nil, false // filters and negations need the clip itself
+}
+
+// substring looks up the docs that may contain text
+func (ix *index) substring(text string) ([]uint32, bool) {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	grams := make(map[gram]struct{})
+	if len(runes) < 3 {
+		for _, r := range runes {
+			grams[unigram(r)] = struct{}{}
+		}
+	} else {
+		for i := 0; i+2 < len(runes); i++ {
+			grams[trigram(runes[i], runes[i+1], runes[i+2])] = struct{}{}
+		}
+	}
+	return ix.withGrams(grams), len(grams) > 0
+}
+
+// withGrams returns the docs containing every gram, plus the unindexed ones
+func (ix *index) withGrams(grams map[gram]struct{}) []uint32 {
+	lists := make([][]uint32, 0, len(grams))
+	for g := range grams {
+		lists = append(lists, ix.postings[g])
+	}
+	// Intersect the shortest lists first
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	var docs []uint32
+	for i, list := range lists {
+		if i == 0 {
+			docs = append([]uint32(nil), list...)
+		} else {
+			docs = intersect(docs, list)
+		}
+		if len(docs) == 0 {
+			break
+		}
+	}
+
+	if len(ix.unindexed) > 0 {
+		extra := make([]uint32, 0, len(ix.unindexed))
+		for n := range ix.unindexed {
+			extra = append(extra, n)
+		}
+		sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+		docs = union(docs, extra)
+	}
+	return docs
+}
+
+// addGrams adds the lowercased characters and trigrams of text to grams
+func addGrams(grams map[gram]struct{}, text []rune) {
+	for i, r := range text {
+		text[i] = unicode.ToLower(r)
+		grams[unigram(text[i])] = struct{}{}
+		if i >= 2 {
+			grams[trigram(text[i-2], text[i-1], text[i])] = struct{}{}
+		}
+	}
+}
+
+func contentHash(content string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(content))
+	return h.Sum64()
+}
+
+// intersect returns the doc numbers in both ascending lists
+func intersect(a, b []uint32) []uint32 {
+	out := a[:0:0]
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// union returns the doc numbers in either ascending list
+func union(a, b []uint32) []uint32 {
+	out := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// indexCandidates parses query and returns the index's candidates for it
+func indexCandidates(t *testing.T, ix *index, query string) ([]int64, bool) {
+	t.Helper()
+	q, err := ParseQuery(query, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", query, err)
+	}
+	return ix.candidates(q.root, false)
+}
+
+func TestIndex_Candidates(t *testing.T) {
+	ix := newIndex()
+	for i, content := range []string{"docker ps -a", "git push origin", "Hello World", "kubectl get pods"} {
+		ix.touch(Clip{ID: int64(i + 1), Content: content})
+	}
+
+	tests := []struct {
+		query string
+		ids   []int64
+		ok    bool
+	}{
+		{`"push"`, []int64{2}, true},
+		{`"WORLD"`, []int64{3}, true},    // grams ignore case
+		{`dps`, []int64{1, 4}, true},     // a word needs its characters, in any order
+		{`"po"`, []int64{1, 2, 4}, true}, // short phrases fall back to characters
+		{`/pu[s]h/`, []int64{2}, true},   // regexes narrow by their literal prefix
+		{`git | hello`, []int64{2, 3}, true},
+		{`git type:text`, []int64{2}, true},
+		{`"zzz"`, []int64{}, true},
+		{`type:text`, nil, false}, // filters need the clip itself
+		{`-git`, nil, false},
+		{`git | pinned:true`, nil, false},
+		{`/.*/`, nil, false},
+	}
+	for _, tt := range tests {
+		ids, ok := indexCandidates(t, ix, tt.query)
+		if ok != tt.ok || (ok && !reflect.DeepEqual(ids, tt.ids)) {
+			t.Errorf("candidates(%q) = %v, %v; want %v, %v", tt.query, ids, ok, tt.ids, tt.ok)
+		}
+	}
+
+	// Verbatim, a word narrows by its trigrams like a phrase
+	q, _ := ParseQuery("dps push", time.Now())
+	if ids, ok := ix.candidates(q.root, true); !ok || len(ids) != 0 {
+		t.Errorf("verbatim candidates(dps push) = %v, %v; want none", ids, ok)
+	}
+	q, _ = ParseQuery("PUSH", time.Now())
+	if ids, ok := ix.candidates(q.root, true); !ok || !reflect.DeepEqual(ids, []int64{2}) {
+		t.Errorf("verbatim candidates(PUSH) = %v, %v; want [2]", ids, ok)
+	}
+}
+
+func TestIndex_Maintained(t *testing.T) {
+	ix := newIndex()
+	ix.touch(Clip{ID: 1, Content: "alpha"})
+	ix.touch(Clip{ID: 2, Content: "beta", Pinned: true})
+	ix.touch(Clip{ID: 3, Content: "gamma"})
+
+	// A duplicate moves to the front without changing the pin
+	ix.touch(Clip{ID: 1, Content: "alpha"})
+	if ix.age(1) != 0 || ix.age(3) != 1 {
+		t.Errorf("Expected ages 0 and 1, got %d and %d", ix.age(1), ix.age(3))
+	}
+	if got := ix.pinnedIDs(); !reflect.DeepEqual(got, []int64{2}) {
+		t.Errorf("Expected pinned [2], got %v", got)
+	}
+
+	ix.update(Clip{ID: 3, Content: "delta", Pinned: true})
+	if ids, _ := indexCandidates(t, ix, `"gamma"`); len(ids) != 0 {
+		t.Errorf("Expected the old content to be forgotten, got %v", ids)
+	}
+	if ids, _ := indexCandidates(t, ix, `"delta"`); !reflect.DeepEqual(ids, []int64{3}) {
+		t.Errorf("Expected the new content to be indexed, got %v", ids)
+	}
+	if got := ix.pinnedIDs(); !reflect.DeepEqual(got, []int64{3, 2}) {
+		t.Errorf("Expected pinned [3 2], got %v", got)
+	}
+
+	ix.remove(2)
+	if ids, _ := indexCandidates(t, ix, `"beta"`); len(ids) != 0 {
+		t.Errorf("Expected a removed clip to be gone, got %v", ids)
+	}
+	if got := ix.pinnedIDs(); !reflect.DeepEqual(got, []int64{3}) {
+		t.Errorf("Expected pinned [3], got %v", got)
+	}
+}
+
+func TestIndex_Unindexed(t *testing.T) {
+	ix := newIndex()
+	ix.touch(Clip{ID: 1, Content: "short"})
+	long := make([]byte, maxIndexedContent+1)
+	for i := range long {
+		long[i] = 'x'
+	}
+	ix.touch(Clip{ID: 2, Content: string(long)})
+
+	// A clip too long to index is a candidate for everything
+	if ids, _ := indexCandidates(t, ix, `"short"`); !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("Expected [1 2], got %v", ids)
+	}
+}
+
+func TestStorage_SearchIndex(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		for i := 0; i < 7; i++ {
+			store.Add(Clip{Content: fmt.Sprintf("note %d", i), Type: "text", Timestamp: time.Now()})
+		}
+		ids := func(query string) []int64 {
+			results, err := store.Search(query, 10)
+			if err != nil {
+				t.Fatalf("Failed to search %q: %v", query, err)
+			}
+			var ids []int64
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			return ids
+		}
+
+		// Notes 0 and 1 were evicted, 4 is removed
+		store.Remove(5)
+		if got := ids(`"note"`); !reflect.DeepEqual(got, []int64{7, 6, 4, 3}) {
+			t.Fatalf("Expected [7 6 4 3], got %v", got)
+		}
+		if got := ids(`"note 1"`); len(got) != 0 {
+			t.Fatalf("Expected the evicted clip to be gone, got %v", got)
+		}
+
+		// A duplicate is the most recent again, and restoring brings a clip back
+		store.Add(Clip{Content: "note 2", Type: "text", Timestamp: time.Now()})
+		store.Restore(5)
+		if got := ids(`"note"`); len(got) != 5 || got[0] != 5 || got[1] != 3 {
+			t.Fatalf("Expected clips 5 and 3 first, got %v", got)
+		}
+
+		store.Pin(6)
+		if pinned, _ := store.GetPinned(); len(pinned) != 1 || pinned[0].ID != 6 {
+			t.Fatalf("Expected clip 6 pinned, got %+v", pinned)
+		}
+	})
+}
+
+func TestStorage_IndexCompaction(t *testing.T) {
+	store, _ := NewStorage(4 * compactAfter)
+	for i := 0; i < 2*compactAfter; i++ {
+		store.Add(Clip{Content: fmt.Sprintf("clip %d", i), Type: "text", Timestamp: time.Now()})
+	}
+	store.Clear(false)
+	last, _ := store.Add(Clip{Content: "survivor", Type: "text", Timestamp: time.Now()})
+
+	if store.index.dead != 0 || len(store.index.docs) != 1 {
+		t.Fatalf("Expected the index to be compacted, got %d docs, %d dead", len(store.index.docs), store.index.dead)
+	}
+	if results, _ := store.Search("survivor", 10); len(results) != 1 || results[0].ID != last {
+		t.Fatalf("Expected clip %d found after compaction, got %+v", last, results)
+	}
+}
@@ -7,18 +7,25 @@ import (
 
 // MemoryStore stores clips in memory with LRU eviction
 type MemoryStore struct {
-	elements map[int64]*list.Element
-	order    *list.List
-	mu       sync.RWMutex
-	nextID   int64
+	elements  map[int64]*list.Element
+	order     *list.List
+	byContent map[uint64][]int64 // clip IDs by contentKey, for dedup
+	keyOf     func(Clip) uint64
+	noDedup   bool // Add stores duplicates as new clips
+	keepTags  bool // EvictOldest skips tagged clips too
+	mu        sync.RWMutex
+	nextID    int64
+	bytes     int64 // total Size of the stored clips
 }
 
 // NewMemoryStore creates a new in-memory store
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		elements: make(map[int64]*list.Element),
-		order:    list.New(),
-		nextID:   1,
+		elements:  make(map[int64]*list.Element),
+		order:     list.New(),
+		byContent: make(map[uint64][]int64),
+		keyOf:     contentKey,
+		nextID:    1,
 	}
 }
 
@@ -28,25 +35,42 @@ func (m *MemoryStore) Add(clip Clip) (int64, error) {
 	defer m.mu.Unlock()
 
 	// Check if this content already exists (deduplicate)
-	for id, elem := range m.elements {
-		stored := elem.Value.(Clip)
-		if stored.Content == clip.Content && stored.Type == clip.Type {
-			// Move to front (most recently used)
-			m.order.MoveToFront(elem)
-			return id, nil
+	key := m.keyOf(clip)
+	if !m.noDedup {
+		for _, id := range m.byContent[key] {
+			elem := m.elements[id]
+			if sameContent(elem.Value.(Clip), clip) {
+				// Move to front (most recently used)
+				m.order.MoveToFront(elem)
+				return id, nil
+			}
 		}
 	}
 
-	clip.ID = m.nextID
-	m.nextID++
+	// Keep a caller-supplied ID (e.g. when reloading from disk)
+	if clip.ID == 0 {
+		clip.ID = m.nextID
+	}
+	if clip.ID >= m.nextID {
+		m.nextID = clip.ID + 1
+	}
 
 	// Store in list (front = most recent)
 	elem := m.order.PushFront(clip)
 	m.elements[clip.ID] = elem
+	m.byContent[key] = append(m.byContent[key], clip.ID)
+	m.bytes += clip.Size()
 
 	return clip.ID, nil
 }
 
+// SetDedup turns deduplication in Add on or off
+func (m *MemoryStore) SetDedup(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.noDedup = !enabled
+}
+
 // Get retrieves a clip by ID
 func (m *MemoryStore) Get(id int64) (Clip, bool) {
 	m.mu.RLock()
@@ -75,6 +99,18 @@ func (m *MemoryStore) List(limit int) []Clip {
 	return result
 }
 
+// Each calls fn for every clip, most recent first, until fn returns false
+func (m *MemoryStore) Each(fn func(Clip) bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for elem := m.order.Front(); elem != nil; elem = elem.Next() {
+		if !fn(elem.Value.(Clip)) {
+			return
+		}
+	}
+}
+
 // Remove removes a clip from memory
 func (m *MemoryStore) Remove(id int64) bool {
 	m.mu.Lock()
@@ -85,8 +121,7 @@ func (m *MemoryStore) Remove(id int64) bool {
 		return false
 	}
 
-	m.order.Remove(elem)
-	delete(m.elements, id)
+	m.forget(elem)
 	return true
 }
 
@@ -100,26 +135,79 @@ func (m *MemoryStore) Update(clip Clip) bool {
 		return false
 	}
 
+	old := elem.Value.(Clip)
+	if key := m.keyOf(clip); key != m.keyOf(old) {
+		m.unkey(old)
+		m.byContent[key] = append(m.byContent[key], clip.ID)
+	}
+	m.bytes += clip.Size() - old.Size()
 	elem.Value = clip
 	return true
 }
 
-// EvictOldest removes the oldest unpinned clip, skipping pinned ones
-func (m *MemoryStore) EvictOldest() bool {
+// SetProtectTagged sets whether EvictOldest skips tagged clips as well
+func (m *MemoryStore) SetProtectTagged(protect bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keepTags = protect
+}
+
+// EvictOldest removes and returns the oldest unpinned clip, skipping pinned
+// ones (and tagged ones, if protected)
+func (m *MemoryStore) EvictOldest() (Clip, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Walk from back (oldest) toward front, skip pinned clips
 	for elem := m.order.Back(); elem != nil; elem = elem.Prev() {
 		clip := elem.Value.(Clip)
-		if !clip.Pinned {
-			m.order.Remove(elem)
-			delete(m.elements, clip.ID)
-			return true
+		if !clip.Pinned && !(m.keepTags && len(clip.Tags) > 0) {
+			m.forget(elem)
+			return clip, true
 		}
 	}
 
-	return false
+	return Clip{}, false
+}
+
+// removeOldest removes the least recent clip regardless of pin status
+func (m *MemoryStore) removeOldest() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem := m.order.Back()
+	if elem == nil {
+		return false
+	}
+	m.forget(elem)
+	return true
+}
+
+// forget removes a clip's element and its dedup entry; the caller holds the
+// write lock
+func (m *MemoryStore) forget(elem *list.Element) {
+	clip := elem.Value.(Clip)
+	m.order.Remove(elem)
+	delete(m.elements, clip.ID)
+	m.unkey(clip)
+	m.bytes -= clip.Size()
+}
+
+// unkey drops a clip from the dedup entry of its content
+func (m *MemoryStore) unkey(clip Clip) {
+	key := m.keyOf(clip)
+	ids := m.byContent[key]
+	for i, id := range ids {
+		if id == clip.ID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(m.byContent, key)
+	} else {
+		m.byContent[key] = ids
+	}
 }
 
 // Count returns the number of clips in memory
@@ -129,6 +217,13 @@ func (m *MemoryStore) Count() int {
 	return m.order.Len()
 }
 
+// Bytes returns the total Size of the clips in memory
+func (m *MemoryStore) Bytes() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.bytes
+}
+
 // Clear removes all clips from memory
 func (m *MemoryStore) Clear() {
 	m.mu.Lock()
@@ -136,5 +231,7 @@ func (m *MemoryStore) Clear() {
 
 	m.elements = make(map[int64]*list.Element)
 	m.order = list.New()
+	m.byContent = make(map[uint64][]int64)
 	m.nextID = 1
+	m.bytes = 0
 }
@@ -101,7 +101,7 @@ func TestMemoryStore_EvictOldest(t *testing.T) {
 
 	initialCount := store.Count()
 
-	evicted := store.EvictOldest()
+	_, evicted := store.EvictOldest()
 	if !evicted {
 		t.Fatal("Failed to evict oldest clip")
 	}
@@ -181,7 +181,7 @@ func TestMemoryStore_EvictOldest_SkipsPinned(t *testing.T) {
 	}
 
 	// Evict should skip pinned and remove the unpinned one (clip 3, content "c")
-	evicted := store.EvictOldest()
+	_, evicted := store.EvictOldest()
 	if !evicted {
 		t.Fatal("Expected eviction to succeed")
 	}
@@ -199,7 +199,7 @@ func TestMemoryStore_EvictOldest_SkipsPinned(t *testing.T) {
 	}
 
 	// Another eviction should fail (all pinned)
-	evicted = store.EvictOldest()
+	_, evicted = store.EvictOldest()
 	if evicted {
 		t.Fatal("Expected eviction to fail when all clips are pinned")
 	}
@@ -221,3 +221,135 @@ func TestMemoryStore_Deduplication(t *testing.T) {
 		t.Fatalf("Expected same ID for duplicate content, got %d and %d", id1, id2)
 	}
 }
+
+func TestMemoryStore_Add_KeepsID(t *testing.T) {
+	store := NewMemoryStore()
+
+	id, _ := store.Add(Clip{ID: 7, Content: "restored", Type: "text"})
+	if id != 7 {
+		t.Fatalf("Expected caller-supplied ID 7, got %d", id)
+	}
+
+	// New clips continue after the highest ID seen
+	id, _ = store.Add(Clip{Content: "new", Type: "text"})
+	if id != 8 {
+		t.Fatalf("Expected next ID 8, got %d", id)
+	}
+}
+
+func TestMemoryStore_Each(t *testing.T) {
+	store := NewMemoryStore()
+
+	for i := 0; i < 3; i++ {
+		store.Add(Clip{Content: "content " + string(rune('a'+i)), Type: "text"})
+	}
+
+	// Most recent first, stopping when fn returns false
+	var seen []string
+	store.Each(func(c Clip) bool {
+		seen = append(seen, c.Content)
+		return len(seen) < 2
+	})
+
+	if len(seen) != 2 || seen[0] != "content c" || seen[1] != "content b" {
+		t.Fatalf("Expected [content c, content b], got %v", seen)
+	}
+}
+
+func TestMemoryStore_Bytes(t *testing.T) {
+	store := NewMemoryStore()
+
+	a, _ := store.Add(Clip{Content: "12345", Type: "text", Timestamp: time.Now()})
+	store.Add(Clip{Content: "123", Type: "text", Timestamp: time.Now(), Formats: map[string][]byte{"text/html": []byte("12")}})
+	store.Add(Clip{Content: "12345", Type: "text", Timestamp: time.Now()}) // duplicate
+	if got := store.Bytes(); got != 10 {
+		t.Fatalf("Expected 10 bytes, got %d", got)
+	}
+
+	clip, _ := store.Get(a)
+	clip.Content = "1"
+	store.Update(clip)
+	if got := store.Bytes(); got != 6 {
+		t.Fatalf("Expected 6 bytes after update, got %d", got)
+	}
+
+	store.Remove(a)
+	store.EvictOldest()
+	if got := store.Bytes(); got != 0 {
+		t.Fatalf("Expected 0 bytes once empty, got %d", got)
+	}
+}
+
+func TestMemoryStore_Deduplication_Collisions(t *testing.T) {
+	store := NewMemoryStore()
+	store.keyOf = func(Clip) uint64 { return 42 } // every clip collides
+
+	a, _ := store.Add(Clip{Content: "a", Type: "text"})
+	b, _ := store.Add(Clip{Content: "b", Type: "text"})
+	if a == b {
+		t.Fatal("Expected colliding but different content to get separate IDs")
+	}
+	if id, _ := store.Add(Clip{Content: "b", Type: "text"}); id != b {
+		t.Fatalf("Expected duplicate b to dedup to %d, got %d", b, id)
+	}
+	if id, _ := store.Add(Clip{Content: "a", Type: "files"}); id == a {
+		t.Fatal("Expected the same content of another type not to dedup")
+	}
+
+	store.Remove(a)
+	if id, _ := store.Add(Clip{Content: "b", Type: "text"}); id != b {
+		t.Fatalf("Expected b to still dedup after removing a, got %d", id)
+	}
+	if id, _ := store.Add(Clip{Content: "a", Type: "text"}); id == a {
+		t.Fatal("Expected removed content to get a new ID")
+	}
+}
+
+func TestMemoryStore_Deduplication_Consistency(t *testing.T) {
+	store := NewMemoryStore()
+	add := func(content string) int64 {
+		id, _ := store.Add(Clip{Content: content, Type: "text", Timestamp: time.Now()})
+		return id
+	}
+
+	// Update re-keys changed content
+	a := add("old")
+	clip, _ := store.Get(a)
+	clip.Content = "new"
+	store.Update(clip)
+	if id := add("new"); id != a {
+		t.Fatalf("Expected updated content to dedup to %d, got %d", a, id)
+	}
+	if id := add("old"); id == a {
+		t.Fatal("Expected the content replaced by Update not to dedup")
+	}
+
+	// Evicted and cleared content is forgotten
+	store.Add(Clip{Content: "pinned", Type: "text", Pinned: true})
+	evicted, _ := store.EvictOldest()
+	if id := add(evicted.Content); id == evicted.ID {
+		t.Fatal("Expected evicted content to get a new ID")
+	}
+
+	store.Clear()
+	if len(store.byContent) != 0 {
+		t.Fatalf("Expected no dedup entries after Clear, got %d", len(store.byContent))
+	}
+	if id := add("new"); id != 1 {
+		t.Fatalf("Expected ID 1 after Clear, got %d", id)
+	}
+
+	// Every stored clip has exactly one entry, under its own key
+	entries := 0
+	for key, ids := range store.byContent {
+		for _, id := range ids {
+			if clip, ok := store.Get(id); !ok || contentKey(clip) != key {
+				t.Fatalf("Stale dedup entry for clip %d", id)
+			}
+			entries++
+		}
+	}
+	if entries != store.Count() {
+		t.Fatalf("Expected %d dedup entries, got %d", store.Count(), entries)
+	}
+}
@@ -1,12 +1,80 @@
 package storage
 
-import "time"
+import (
+	"hash/fnv"
+	"io"
+	"time"
+)
 
 // Clip represents a clipboard entry
 type Clip struct {
 	ID        int64
 	Content   string
-	Type      string // "text", "image"
+	Type      string // "text", "image", "files"
 	Timestamp time.Time
 	Pinned    bool
+	Sensitive bool      // copying it back clears the clipboard after a while
+	Source    string    // selection the clip was first captured from: "clipboard" or "primary"
+	ExpiresAt time.Time // zero means the clip never expires
+
+	// Dedup hits: how often the clip was copied again after it was first
+	// captured, and when it last was (zero if never)
+	Hits       int
+	LastCopied time.Time
+
+	// Copies counts how often the clip was copied back to the clipboard
+	// from history, LastUsed is when it last was (zero if never)
+	Copies   int
+	LastUsed time.Time
+
+	// Tags are the sorted, lower-case names the clip is filed under
+	Tags []string
+
+	// Image clips carry the PNG itself; Content is empty
+	Data      []byte // PNG data
+	Width     int
+	Height    int
+	Hash      string // hex SHA-256 of Data, used for dedup
+	Thumbnail []byte // small PNG preview
+
+	// Formats holds extra representations of the clip (e.g. text/html, text/rtf)
+	// by MIME type; dedup only considers the primary content
+	Formats map[string][]byte
+
+	// Files lists the copied files of a "files" clip; Content holds their
+	// paths, one per line
+	Files []File
+}
+
+// Size returns the bytes a clip takes up: its content and every stored
+// representation, which is what the history byte budget counts
+func (c Clip) Size() int64 {
+	n := len(c.Content) + len(c.Data) + len(c.Thumbnail)
+	for _, data := range c.Formats {
+		n += len(data)
+	}
+	return int64(n) // a files clip's paths are its Content
+}
+
+// File is one entry of a copied file list, as found at capture time
+type File struct {
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	Size   int64  `json:"size"` // bytes; 0 for directories and missing files
+}
+
+// sameContent reports whether two clips hold the same content (dedup check)
+func sameContent(a, b Clip) bool {
+	return a.Type == b.Type && a.Hash == b.Hash && a.Content == b.Content
+}
+
+// contentKey hashes what sameContent compares, so equal content always has
+// equal keys (unequal content rarely does)
+func contentKey(c Clip) uint64 {
+	h := fnv.New64a()
+	for _, s := range []string{c.Type, c.Hash, c.Content} {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
 }
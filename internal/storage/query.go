@@ -0,0 +1,560 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query is a parsed search query. Words match fuzzily, "quoted phrases" as
+// substrings and /patterns/ as regular expressions; filters such as
+// type:image, pinned:true, after:2026-10-01, before:1h and len>200 narrow the
+// results. Terms are ANDed; OR (or |) joins alternatives, a leading - (or !)
+// negates a term and parentheses group.
+type Query struct {
+	root  queryNode   // nil matches every clip
+	terms []fuzzyTerm // words outside any negation, which rank the results
+}
+
+// QueryError describes why a query could not be parsed
+type QueryError struct {
+	Pos     int    // byte offset in the query where the problem is
+	Token   string // the offending part of the query, if any
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("invalid query at %d: %s", e.Pos, e.Message)
+	}
+	return fmt.Sprintf("invalid query at %d (%q): %s", e.Pos, e.Token, e.Message)
+}
+
+// ParseQuery parses query; relative times such as before:1h count back from now
+func ParseQuery(query string, now time.Time) (Query, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return Query{}, err
+	}
+	p := &queryParser{tokens: tokens, now: now, end: len(query)}
+	if len(tokens) == 0 {
+		return Query{}, nil
+	}
+	root, err := p.parseOr(false)
+	if err != nil {
+		return Query{}, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return Query{}, &QueryError{Pos: tok.pos, Token: tok.raw, Message: "unexpected " + tok.describe()}
+	}
+	return Query{root: root, terms: p.terms}, nil
+}
+
+// Match reports whether clip satisfies the query
+func (q Query) Match(clip Clip) bool {
+	if q.root == nil {
+		return true
+	}
+	return q.root.match(&candidate{clip: clip})
+}
+
+// score rates how well the query's words match text, with their positions
+func (q Query) score(text string) (int, []int) {
+	if len(q.terms) == 0 {
+		return 0, nil
+	}
+	return scoreTerms(q.terms, []rune(text), true)
+}
+
+// matchScore is Match followed by score without the positions, converting
+// the content to runes only once
+func (q Query) matchScore(clip Clip) (int, bool) {
+	c := &candidate{clip: clip}
+	if q.root != nil && !q.root.match(c) {
+		return 0, false
+	}
+	if len(q.terms) == 0 {
+		return 0, true
+	}
+	score, _ := scoreTerms(q.terms, c.text(), false)
+	return score, true
+}
+
+// candidate is a clip being matched, caching its content as runes
+type candidate struct {
+	clip  Clip
+	runes []rune
+}
+
+func (c *candidate) text() []rune {
+	if c.runes == nil {
+		c.runes = []rune(c.clip.Content)
+	}
+	return c.runes
+}
+
+// queryNode is one compiled term or operator of a query
+type queryNode interface {
+	match(c *candidate) bool
+}
+
+type andNode []queryNode
+
+func (n andNode) match(c *candidate) bool {
+	for _, child := range n {
+		if !child.match(c) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []queryNode
+
+func (n orNode) match(c *candidate) bool {
+	for _, child := range n {
+		if child.match(c) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct{ child queryNode }
+
+func (n notNode) match(c *candidate) bool { return !n.child.match(c) }
+
+// wordNode matches a word fuzzily, like the fuzzy search
+type wordNode struct{ term fuzzyTerm }
+
+func (n wordNode) match(c *candidate) bool { return n.term.contains(c.text()) }
+
+// phraseNode matches a smart-case substring
+type phraseNode struct {
+	text          string
+	caseSensitive bool
+}
+
+func (n phraseNode) match(c *candidate) bool {
+	if n.caseSensitive {
+		return strings.Contains(c.clip.Content, n.text)
+	}
+	return strings.Contains(strings.ToLower(c.clip.Content), n.text)
+}
+
+type regexNode struct{ re *regexp.Regexp }
+
+func (n regexNode) match(c *candidate) bool { return n.re.MatchString(c.clip.Content) }
+
+// filterNode is a key:value filter compiled to a predicate
+type filterNode func(Clip) bool
+
+func (n filterNode) match(c *candidate) bool { return n(c.clip) }
+
+// lenNode compares the length of a clip's content in characters
+type lenNode struct {
+	op string
+	n  int
+}
+
+func (n lenNode) match(c *candidate) bool {
+	length := utf8.RuneCountInString(c.clip.Content)
+	switch n.op {
+	case ">":
+		return length > n.n
+	case ">=":
+		return length >= n.n
+	case "<":
+		return length < n.n
+	case "<=":
+		return length <= n.n
+	}
+	return length == n.n
+}
+
+// Query tokens
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokRegex
+	tokOr
+	tokNot
+	tokOpen
+	tokClose
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string // words, phrases and regexes without their quotes or slashes
+	raw  string // as written
+	pos  int
+}
+
+func (t queryToken) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokOr:
+		return "OR"
+	case tokClose:
+		return `")"`
+	}
+	return fmt.Sprintf("%q", t.raw)
+}
+
+// tokenizeQuery splits a query into words, "phrases", /regexes/, OR, - and parentheses
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokOpen, raw: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokClose, raw: ")", pos: i})
+			i++
+		case r == '|':
+			tokens = append(tokens, queryToken{kind: tokOr, raw: "|", pos: i})
+			i++
+		case (r == '-' || r == '!') && i+1 < len(query) && !isQuerySpace(query[i+1]):
+			tokens = append(tokens, queryToken{kind: tokNot, raw: string(r), pos: i})
+			i++
+		case r == '"':
+			text, n, err := readDelimited(query, i, '"')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokPhrase, text: text, raw: query[i : i+n], pos: i})
+			i += n
+		case r == '/':
+			text, n, err := readDelimited(query, i, '/')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokRegex, text: text, raw: query[i : i+n], pos: i})
+			i += n
+		default:
+			tok, n, err := readWord(query, i)
+			if err != nil {
+				return nil, err
+			}
+			if tok.text == "OR" {
+				tok.kind = tokOr
+			}
+			if tok.text != "AND" { // AND is what juxtaposition means anyway
+				tokens = append(tokens, tok)
+			}
+			i += n
+		}
+	}
+	return tokens, nil
+}
+
+func isQuerySpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// readDelimited reads a "phrase" or /regex/ starting at query[start], where
+// a backslash escapes the delimiter, and returns its text and length
+func readDelimited(query string, start int, delim byte) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(query); i++ {
+		switch {
+		case query[i] == '\\' && i+1 < len(query) && query[i+1] == delim:
+			b.WriteByte(delim)
+			i++
+		case query[i] == delim:
+			return b.String(), i + 1 - start, nil
+		default:
+			b.WriteByte(query[i])
+		}
+	}
+	what := "quote"
+	if delim == '/' {
+		what = "regex"
+	}
+	return "", 0, &QueryError{Pos: start, Token: query[start:], Message: "unterminated " + what}
+}
+
+// readWord reads a word up to whitespace or a parenthesis; a quoted part, as
+// in after:"2026-10-01T09:00", may contain either
+func readWord(query string, start int) (queryToken, int, error) {
+	var b strings.Builder
+	i := start
+	for i < len(query) && !isQuerySpace(query[i]) && query[i] != '(' && query[i] != ')' {
+		if query[i] == '"' {
+			text, n, err := readDelimited(query, i, '"')
+			if err != nil {
+				return queryToken{}, 0, err
+			}
+			b.WriteString(text)
+			i += n
+			continue
+		}
+		b.WriteByte(query[i])
+		i++
+	}
+	return queryToken{kind: tokWord, text: b.String(), raw: query[start:i], pos: start}, i - start, nil
+}
+
+// queryParser builds a Query from tokens by recursive descent:
+//
+//	or    = and { OR and }
+//	and   = unary { unary }
+//	unary = "-" unary | "(" or ")" | term
+type queryParser struct {
+	tokens []queryToken
+	next   int
+	now    time.Time
+	end    int // length of the query, the position of tokEOF
+	terms  []fuzzyTerm
+}
+
+func (p *queryParser) peek() queryToken {
+	if p.next < len(p.tokens) {
+		return p.tokens[p.next]
+	}
+	return queryToken{kind: tokEOF, pos: p.end}
+}
+
+func (p *queryParser) take() queryToken {
+	tok := p.peek()
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *queryParser) parseOr(negated bool) (queryNode, error) {
+	first, err := p.parseAnd(negated)
+	if err != nil {
+		return nil, err
+	}
+	nodes := orNode{first}
+	for p.peek().kind == tokOr {
+		p.take()
+		next, err := p.parseAnd(negated)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, next)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) parseAnd(negated bool) (queryNode, error) {
+	var nodes andNode
+	for {
+		switch p.peek().kind {
+		case tokEOF, tokOr, tokClose:
+			if len(nodes) == 0 {
+				tok := p.peek()
+				return nil, &QueryError{Pos: tok.pos, Token: tok.raw, Message: "expected a search term before " + tok.describe()}
+			}
+			if len(nodes) == 1 {
+				return nodes[0], nil
+			}
+			return nodes, nil
+		}
+		node, err := p.parseUnary(negated)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+func (p *queryParser) parseUnary(negated bool) (queryNode, error) {
+	tok := p.take()
+	switch tok.kind {
+	case tokNot:
+		child, err := p.parseUnary(!negated)
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child}, nil
+	case tokOpen:
+		node, err := p.parseOr(negated)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != tokClose {
+			return nil, &QueryError{Pos: tok.pos, Token: "(", Message: "unclosed parenthesis"}
+		}
+		return node, nil
+	case tokPhrase:
+		caseSensitive := strings.IndexFunc(tok.text, unicode.IsUpper) >= 0
+		text := tok.text
+		if !caseSensitive {
+			text = strings.ToLower(text)
+		}
+		return phraseNode{text: text, caseSensitive: caseSensitive}, nil
+	case tokRegex:
+		re, err := regexp.Compile(tok.text)
+		if err != nil {
+			return nil, &QueryError{Pos: tok.pos, Token: tok.raw, Message: "invalid regex: " + err.Error()}
+		}
+		return regexNode{re}, nil
+	}
+	return p.parseWord(tok, negated)
+}
+
+// lenFilter matches len>200, len<=10, len:42 and the like
+var lenFilter = regexp.MustCompile(`^len(>=|<=|>|<|=|:)(.*)$`)
+
+// parseWord compiles a filter such as type:image, or else a fuzzy word
+func (p *queryParser) parseWord(tok queryToken, negated bool) (queryNode, error) {
+	if m := lenFilter.FindStringSubmatch(tok.text); m != nil {
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n < 0 {
+			return nil, &QueryError{Pos: tok.pos, Token: tok.raw, Message: "len needs a number of characters, e.g. len>200"}
+		}
+		return lenNode{op: m[1], n: n}, nil
+	}
+
+	key, value, isFilter := strings.Cut(tok.text, ":")
+	if isFilter {
+		key = strings.ToLower(key)
+		if parse, ok := queryFilters[key]; ok {
+			if value == "" {
+				return nil, &QueryError{Pos: tok.pos, Token: tok.raw, Message: key + ": needs a value"}
+			}
+			match, err := parse(value, p.now)
+			if err != nil {
+				return nil, &QueryError{Pos: tok.pos, Token: tok.raw, Message: key + ": " + err.Error()}
+			}
+			return filterNode(match), nil
+		}
+	}
+
+	term := newFuzzyTerm(tok.text)
+	if !negated {
+		p.terms = append(p.terms, term)
+	}
+	return wordNode{term}, nil
+}
+
+// queryFilters compile the value of each key:value filter; other words with
+// a colon (e.g. URLs) are searched for as they are
+var queryFilters = map[string]func(value string, now time.Time) (func(Clip) bool, error){
+	"type":   parseTypeFilter,
+	"pinned": parsePinnedFilter,
+	"after":  parseTimeFilter(true),
+	"before": parseTimeFilter(false),
+	"source": parseSourceFilter,
+	"tag":    parseTagFilter,
+	"app":    parseAppFilter,
+}
+
+func parseTagFilter(value string, _ time.Time) (func(Clip) bool, error) {
+	tag, err := NormalizeTag(value)
+	if err != nil {
+		return nil, err
+	}
+	return func(clip Clip) bool { return clip.HasTag(tag) }, nil
+}
+
+func parseTypeFilter(value string, _ time.Time) (func(Clip) bool, error) {
+	switch value = strings.ToLower(value); value {
+	case "text", "image", "files":
+		return func(clip Clip) bool { return clip.Type == value }, nil
+	case "url":
+		return func(clip Clip) bool { return clip.Type == "text" && isURL(clip.Content) }, nil
+	}
+	return nil, fmt.Errorf("unknown type %q (want text, image, files or url)", value)
+}
+
+// isURL reports whether text is a single absolute URL
+func isURL(text string) bool {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.IndexFunc(text, unicode.IsSpace) >= 0 {
+		return false
+	}
+	u, err := url.Parse(text)
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Scheme == "mailto")
+}
+
+func parsePinnedFilter(value string, _ time.Time) (func(Clip) bool, error) {
+	pinned, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("want true or false, got %q", value)
+	}
+	return func(clip Clip) bool { return clip.Pinned == pinned }, nil
+}
+
+func parseSourceFilter(value string, _ time.Time) (func(Clip) bool, error) {
+	value = strings.ToLower(value)
+	if value != "clipboard" && value != "primary" {
+		return nil, fmt.Errorf("unknown source %q (want clipboard or primary)", value)
+	}
+	return func(clip Clip) bool { return clip.Source == value }, nil
+}
+
+// parseAppFilter rejects app:, so it fails loudly instead of matching nothing:
+// neither macOS nor Wayland says reliably which application put content on
+// the clipboard, so clips don't record it
+func parseAppFilter(string, time.Time) (func(Clip) bool, error) {
+	return nil, fmt.Errorf("not supported: clips don't record the application they were copied from")
+}
+
+// parseTimeFilter compiles after: (at or after) or before: (strictly before).
+// The value is a date, a date and time, or an age such as 1h, 3d or 2w.
+func parseTimeFilter(after bool) func(string, time.Time) (func(Clip) bool, error) {
+	return func(value string, now time.Time) (func(Clip) bool, error) {
+		at, err := parseQueryTime(value, now)
+		if err != nil {
+			return nil, err
+		}
+		if after {
+			return func(clip Clip) bool { return !clip.Timestamp.Before(at) }, nil
+		}
+		return func(clip Clip) bool { return clip.Timestamp.Before(at) }, nil
+	}
+}
+
+// queryTimeLayouts are the absolute times a query accepts, in local time
+var queryTimeLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339}
+
+// parseQueryTime reads an absolute time or an age counted back from now
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	for _, layout := range queryTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if age, err := parseAge(value); err == nil {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("want a date like 2026-10-01 or an age like 1h or 3d, got %q", value)
+}
+
+// parseAge parses a Go duration, or a whole number of days (d) or weeks (w)
+func parseAge(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if unit, ok := units[value[len(value)-1]]; ok {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuery_Match(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+	clips := []Clip{
+		{ID: 1, Type: "text", Content: "https://example.com/docs", Timestamp: now.Add(-10 * time.Minute)},
+		{ID: 2, Type: "text", Content: "SELECT * FROM users", Timestamp: now.Add(-2 * time.Hour), Pinned: true, Tags: []string{"sql", "work"}},
+		{ID: 3, Type: "image", Timestamp: now.Add(-48 * time.Hour)},
+		{ID: 4, Type: "text", Content: "git commit -m \"fix\"", Timestamp: now.Add(-30 * 24 * time.Hour), Source: "primary"},
+		{ID: 5, Type: "files", Content: "/home/me/report.pdf", Timestamp: now.Add(-5 * time.Minute), Tags: []string{"work"}},
+	}
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{1, 2, 3, 4, 5}},
+		{"gcm", []int64{4}},
+		{"type:url", []int64{1}},
+		{"type:image", []int64{3}},
+		{"pinned:true", []int64{2}},
+		{"pinned:false type:text", []int64{1, 4}},
+		{"after:1h", []int64{1, 5}},
+		{"before:1d", []int64{3, 4}},
+		{"after:2026-10-01 before:2026-10-17", []int64{3}},
+		{"len>20", []int64{1}},
+		{"len<=19 type:text", []int64{2, 4}},
+		{"source:primary", []int64{4}},
+		{"tag:work", []int64{2, 5}},
+		{"tag:SQL", []int64{2}},
+		{"-tag:work type:text", []int64{1, 4}},
+		{`/^SELECT\b/`, []int64{2}},
+		{`/\/docs$/`, []int64{1}},
+		{`"from users"`, []int64{2}},
+		{`"FROM users"`, []int64{2}},
+		{`"From users"`, nil}, // a capital makes a phrase case-sensitive
+		{"-type:text", []int64{3, 5}},
+		{"!pinned:false", []int64{2}},
+		{"type:image OR type:files", []int64{3, 5}},
+		{"type:image | pinned:true", []int64{2, 3}},
+		{"(gcm OR select) -pinned:true", []int64{4}},
+		{"-(type:text OR type:files)", []int64{3}},
+		{"https://example.com", []int64{1}}, // unknown keys are plain words
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query, now)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		var got []int64
+		for _, clip := range clips {
+			if q.Match(clip) {
+				got = append(got, clip.ID)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestQuery_Score(t *testing.T) {
+	// Negated words don't rank or highlight
+	q, err := ParseQuery("commit -fix", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, positions := q.score("git commit -m")
+	if len(positions) != 6 || positions[0] != 4 {
+		t.Fatalf("Expected the positions of commit only, got %v", positions)
+	}
+}
+
+func TestParseQuery_Errors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		token string
+	}{
+		{"type:video", 0, "type:video"},
+		{"a pinned:maybe", 2, "pinned:maybe"},
+		{"after:yesterday", 0, "after:yesterday"},
+		{"len>lots", 0, "len>lots"},
+		{"x /[a-/", 2, "/[a-/"},
+		{`"open`, 0, `"open`},
+		{"/open", 0, "/open"},
+		{"(a OR b", 0, "("},
+		{"a OR", 4, ""},
+		{"a )", 2, ")"},
+		{"type:", 0, "type:"},
+		{"tag:work,sql", 0, "tag:work,sql"},
+		{"x app:firefox", 2, "app:firefox"},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query, time.Now())
+		var qerr *QueryError
+		if !errors.As(err, &qerr) {
+			t.Errorf("ParseQuery(%q) = %v, want a *QueryError", tt.query, err)
+			continue
+		}
+		if qerr.Pos != tt.pos || qerr.Token != tt.token || qerr.Message == "" {
+			t.Errorf("ParseQuery(%q) = %+v, want pos %d and token %q", tt.query, qerr, tt.pos, tt.token)
+		}
+	}
+}
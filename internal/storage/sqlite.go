@@ -0,0 +1,437 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver, in pure Go so builds need no cgo
+)
+
+// migrations are applied in order; PRAGMA user_version records how many ran
+var migrations = []string{
+	`CREATE TABLE clips (
+		id        INTEGER PRIMARY KEY,
+		content   TEXT    NOT NULL,
+		type      TEXT    NOT NULL,
+		timestamp INTEGER NOT NULL,
+		pinned    INTEGER NOT NULL DEFAULT 0,
+		seq       INTEGER NOT NULL
+	);
+	CREATE INDEX idx_clips_seq ON clips(seq);
+	CREATE TABLE meta (
+		key   TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	);
+	INSERT INTO meta (key, value) VALUES ('next_id', 1);`,
+
+	`ALTER TABLE clips ADD COLUMN data BLOB;
+	ALTER TABLE clips ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE clips ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE clips ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE clips ADD COLUMN thumbnail BLOB;`,
+
+	`ALTER TABLE clips ADD COLUMN formats BLOB;`,
+
+	`ALTER TABLE clips ADD COLUMN files BLOB;`,
+
+	`ALTER TABLE clips ADD COLUMN source TEXT NOT NULL DEFAULT '';`,
+
+	`ALTER TABLE clips ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;`,
+
+	`ALTER TABLE clips ADD COLUMN sensitive INTEGER NOT NULL DEFAULT 0;`,
+
+	// size is Clip.Size(); existing rows get an estimate (formats and files as stored JSON)
+	`ALTER TABLE clips ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+	UPDATE clips SET size = length(CAST(content AS BLOB)) + COALESCE(length(data), 0) +
+		COALESCE(length(thumbnail), 0) + COALESCE(length(formats), 0) + COALESCE(length(files), 0);`,
+
+	`ALTER TABLE clips ADD COLUMN hits INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE clips ADD COLUMN last_copied INTEGER NOT NULL DEFAULT 0;`,
+
+	`ALTER TABLE clips ADD COLUMN copies INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE clips ADD COLUMN last_used INTEGER NOT NULL DEFAULT 0;`,
+
+	// tags is a JSON list, NULL for none
+	`ALTER TABLE clips ADD COLUMN tags BLOB;`,
+}
+
+// clipColumns lists the stored clip fields in scanClip/clipValues order
+const clipColumns = `id, content, type, timestamp, pinned, data, width, height, hash, thumbnail, formats, files, source, expires_at, sensitive, size, hits, last_copied, copies, last_used, tags`
+
+// clipAssignments sets every column but id, in clipValues order
+const clipAssignments = `content = ?, type = ?, timestamp = ?, pinned = ?, data = ?, width = ?, height = ?, hash = ?, thumbnail = ?, formats = ?, files = ?, source = ?, expires_at = ?, sensitive = ?, size = ?, hits = ?, last_copied = ?, copies = ?, last_used = ?, tags = ?`
+
+// SQLiteStore persists clips in a SQLite database.
+// Recency is tracked with a monotonically increasing seq column (highest = most recent).
+// Methods mirror MemoryStore; the most recent database error is available via Err.
+type SQLiteStore struct {
+	db       *sql.DB
+	mu       sync.Mutex
+	err      error
+	noDedup  bool // Add stores duplicates as new clips
+	keepTags bool // EvictOldest skips tagged clips too
+}
+
+// NewSQLiteStore opens (or creates) the database at path and migrates its schema
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// A single connection serializes writers and avoids SQLITE_BUSY between our own goroutines
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// migrate brings the schema up to the latest version
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to migrate schema: %w", err)
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// Add stores a clip, deduplicating on content and type.
+// A caller-supplied ID is kept; otherwise the next ID is assigned.
+func (s *SQLiteStore) Add(clip Clip) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Check if this content already exists (deduplicate)
+	var id int64
+	err = sql.ErrNoRows
+	if !s.noDedup {
+		err = tx.QueryRow(
+			`SELECT id FROM clips WHERE type = ? AND hash = ? AND content = ?`,
+			clip.Type, clip.Hash, clip.Content,
+		).Scan(&id)
+	}
+	switch {
+	case err == nil:
+		// Move to front (most recently used)
+		if _, err := tx.Exec(`UPDATE clips SET seq = (SELECT MAX(seq) + 1 FROM clips) WHERE id = ?`, id); err != nil {
+			return 0, fmt.Errorf("failed to touch clip %d: %w", id, err)
+		}
+		return id, tx.Commit()
+	case !errors.Is(err, sql.ErrNoRows):
+		return 0, fmt.Errorf("failed to look up clip: %w", err)
+	}
+
+	if clip.ID == 0 {
+		if err := tx.QueryRow(`SELECT value FROM meta WHERE key = 'next_id'`).Scan(&clip.ID); err != nil {
+			return 0, fmt.Errorf("failed to read next id: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO clips (`+clipColumns+`, seq)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM clips))`,
+		clipValues(clip)...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert clip: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE meta SET value = MAX(value, ?) WHERE key = 'next_id'`, clip.ID+1); err != nil {
+		return 0, fmt.Errorf("failed to advance next id: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit clip: %w", err)
+	}
+	return clip.ID, nil
+}
+
+// SetDedup turns deduplication in Add on or off
+func (s *SQLiteStore) SetDedup(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noDedup = !enabled
+}
+
+// Get retrieves a clip by ID
+func (s *SQLiteStore) Get(id int64) (Clip, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row := s.db.QueryRow(`SELECT `+clipColumns+` FROM clips WHERE id = ?`, id)
+	clip, err := scanClip(row)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.err = fmt.Errorf("failed to get clip %d: %w", id, err)
+		}
+		return Clip{}, false
+	}
+	return clip, true
+}
+
+// List returns recent clips (most recent first)
+func (s *SQLiteStore) List(limit int) []Clip {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Clip, 0, limit)
+	s.each(limit, func(clip Clip) bool {
+		result = append(result, clip)
+		return true
+	})
+	return result
+}
+
+// Each calls fn for every clip, most recent first, until fn returns false
+func (s *SQLiteStore) Each(fn func(Clip) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.each(-1, fn)
+}
+
+// each streams up to limit clips (negative = all) in recency order; the caller holds s.mu
+func (s *SQLiteStore) each(limit int, fn func(Clip) bool) {
+	rows, err := s.db.Query(`SELECT `+clipColumns+` FROM clips ORDER BY seq DESC LIMIT ?`, limit)
+	if err != nil {
+		s.err = fmt.Errorf("failed to list clips: %w", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		clip, err := scanClip(rows)
+		if err != nil {
+			s.err = fmt.Errorf("failed to read clip: %w", err)
+			return
+		}
+		if !fn(clip) {
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		s.err = fmt.Errorf("failed to list clips: %w", err)
+	}
+}
+
+// Remove deletes a clip
+func (s *SQLiteStore) Remove(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.exec(fmt.Sprintf("failed to remove clip %d", id), `DELETE FROM clips WHERE id = ?`, id)
+}
+
+// Update writes a modified Clip back by ID, preserving its recency
+func (s *SQLiteStore) Update(clip Clip) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	args := append(clipValues(clip)[1:], clip.ID)
+	return s.exec(
+		fmt.Sprintf("failed to update clip %d", clip.ID),
+		`UPDATE clips SET `+clipAssignments+` WHERE id = ?`,
+		args...,
+	)
+}
+
+// SetProtectTagged sets whether EvictOldest skips tagged clips as well
+func (s *SQLiteStore) SetProtectTagged(protect bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepTags = protect
+}
+
+// EvictOldest removes and returns the oldest unpinned clip, skipping pinned
+// ones (and tagged ones, if protected)
+func (s *SQLiteStore) EvictOldest() (Clip, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row := s.db.QueryRow(`SELECT `+clipColumns+` FROM clips WHERE pinned = 0 AND (? = 0 OR tags IS NULL) ORDER BY seq ASC LIMIT 1`, s.keepTags)
+	clip, err := scanClip(row)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.err = fmt.Errorf("failed to find clip to evict: %w", err)
+		}
+		return Clip{}, false
+	}
+
+	return clip, s.exec(fmt.Sprintf("failed to evict clip %d", clip.ID), `DELETE FROM clips WHERE id = ?`, clip.ID)
+}
+
+// Count returns the number of stored clips
+func (s *SQLiteStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM clips`).Scan(&count); err != nil {
+		s.err = fmt.Errorf("failed to count clips: %w", err)
+		return 0
+	}
+	return count
+}
+
+// Bytes returns the total Size of the stored clips
+func (s *SQLiteStore) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bytes int64
+	if err := s.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM clips`).Scan(&bytes); err != nil {
+		s.err = fmt.Errorf("failed to sum clip sizes: %w", err)
+		return 0
+	}
+	return bytes
+}
+
+// Clear removes all clips and resets ID assignment
+func (s *SQLiteStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`DELETE FROM clips; UPDATE meta SET value = 1 WHERE key = 'next_id'`); err != nil {
+		s.err = fmt.Errorf("failed to clear clips: %w", err)
+	}
+}
+
+// Err returns the most recent database error and resets it
+func (s *SQLiteStore) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.err
+	s.err = nil
+	return err
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// exec runs a statement and reports whether it affected any rows, recording failures in s.err
+func (s *SQLiteStore) exec(errMsg, query string, args ...interface{}) bool {
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		s.err = fmt.Errorf("%s: %w", errMsg, err)
+		return false
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		s.err = fmt.Errorf("%s: %w", errMsg, err)
+		return false
+	}
+	return n > 0
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanClip reads a clip from the columns in clipColumns
+func scanClip(row rowScanner) (Clip, error) {
+	var clip Clip
+	var ts, expires, size, lastCopied, lastUsed int64
+	var formats, files, tags []byte
+	err := row.Scan(
+		&clip.ID, &clip.Content, &clip.Type, &ts, &clip.Pinned,
+		&clip.Data, &clip.Width, &clip.Height, &clip.Hash, &clip.Thumbnail, &formats, &files, &clip.Source, &expires, &clip.Sensitive, &size,
+		&clip.Hits, &lastCopied, &clip.Copies, &lastUsed, &tags,
+	)
+	if err != nil {
+		return Clip{}, err
+	}
+	clip.Timestamp = fromUnixNano(ts)
+	clip.ExpiresAt = fromUnixNano(expires)
+	clip.LastCopied = fromUnixNano(lastCopied)
+	clip.LastUsed = fromUnixNano(lastUsed)
+	if len(formats) > 0 {
+		if err := json.Unmarshal(formats, &clip.Formats); err != nil {
+			return Clip{}, fmt.Errorf("invalid formats for clip %d: %w", clip.ID, err)
+		}
+	}
+	if len(files) > 0 {
+		if err := json.Unmarshal(files, &clip.Files); err != nil {
+			return Clip{}, fmt.Errorf("invalid files for clip %d: %w", clip.ID, err)
+		}
+	}
+	if len(tags) > 0 {
+		if err := json.Unmarshal(tags, &clip.Tags); err != nil {
+			return Clip{}, fmt.Errorf("invalid tags for clip %d: %w", clip.ID, err)
+		}
+	}
+	return clip, nil
+}
+
+// clipValues returns a clip's fields in clipColumns order
+func clipValues(clip Clip) []interface{} {
+	var formats []byte
+	if len(clip.Formats) > 0 {
+		// A map of []byte always marshals
+		formats, _ = json.Marshal(clip.Formats)
+	}
+	var files []byte
+	if len(clip.Files) > 0 {
+		files, _ = json.Marshal(clip.Files)
+	}
+	var tags []byte
+	if len(clip.Tags) > 0 {
+		tags, _ = json.Marshal(clip.Tags)
+	}
+	return []interface{}{
+		clip.ID, clip.Content, clip.Type, toUnixNano(clip.Timestamp), clip.Pinned,
+		clip.Data, clip.Width, clip.Height, clip.Hash, clip.Thumbnail, formats, files, clip.Source, toUnixNano(clip.ExpiresAt), clip.Sensitive, clip.Size(),
+		clip.Hits, toUnixNano(clip.LastCopied), clip.Copies, toUnixNano(clip.LastUsed), tags,
+	}
+}
+
+// toUnixNano converts a timestamp for storage, mapping the zero time to 0
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the inverse of toUnixNano
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
@@ -1,45 +1,227 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"sort"
 	"sync"
+	"time"
+	"unicode/utf8"
 )
 
-// Storage provides in-memory clipboard storage
+// Storage provides clipboard storage over a Backend, adding pinning,
+// count- and size-based eviction and search
 type Storage struct {
-	memory    *MemoryStore
-	maxMemory int
-	mu        sync.RWMutex
+	backend     Backend
+	maxMemory   int
+	maxBytes    int64 // total Size budget; 0 = unlimited
+	maxClipSize int64 // largest Size of one clip; 0 = unlimited
+	truncate    bool  // cut oversize text clips down instead of rejecting them
+	trash       []TrashedClip
+	trashSize   int   // most clips the trash keeps
+	lastOp      int64 // numbers the removals recorded in the trash
+	index       *index
+	dedup       DedupMode
+	mu          sync.RWMutex
+}
+
+// ErrTooLarge is returned by Add for a clip over the per-clip size limit
+var ErrTooLarge = errors.New("clip too large")
+
+// Stats describes what the history holds against its limits
+type Stats struct {
+	Clips       int
+	Pinned      int
+	Bytes       int64
+	MaxClips    int
+	MaxBytes    int64 // 0 = unlimited
+	MaxClipSize int64 // 0 = unlimited
 }
 
 // NewStorage creates a new in-memory storage
 func NewStorage(maxMemory int) (*Storage, error) {
-	return &Storage{
-		memory:    NewMemoryStore(),
+	return NewStorageWithBackend(NewMemoryStore(), maxMemory)
+}
+
+// OpenStorage creates storage persisted to the SQLite database at dbPath,
+// keeping up to hotClips recent clips cached in memory
+func OpenStorage(maxMemory int, dbPath string, hotClips int) (*Storage, error) {
+	disk, err := NewSQLiteStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewStorageWithBackend(NewTieredStore(disk, hotClips), maxMemory)
+	if err != nil {
+		disk.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewStorageWithBackend creates storage over any Backend, evicting right away
+// if the backend already holds more than maxMemory clips
+func NewStorageWithBackend(backend Backend, maxMemory int) (*Storage, error) {
+	s := &Storage{
+		backend:   backend,
 		maxMemory: maxMemory,
-	}, nil
+		trashSize: DefaultTrashSize,
+		dedup:     DedupExact,
+	}
+
+	if err := s.backendErr(); err != nil {
+		return nil, fmt.Errorf("failed to load clips: %w", err)
+	}
+	s.index = buildIndex(backend, nil)
+	if err := s.backendErr(); err != nil {
+		return nil, fmt.Errorf("failed to index clips: %w", err)
+	}
+
+	// The limit may have shrunk since the clips were saved
+	s.evictOverflow()
+	if err := s.backendErr(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// evictOverflow evicts oldest unpinned clips into the trash until under the
+// count and byte limits
+func (s *Storage) evictOverflow() {
+	var evicted []Clip
+	for s.backend.Count() > s.maxMemory || (s.maxBytes > 0 && s.backend.Bytes() > s.maxBytes) {
+		clip, ok := s.backend.EvictOldest()
+		if !ok {
+			break // all remaining clips are pinned (or protected by tags)
+		}
+		evicted = append(evicted, clip)
+		s.index.remove(clip.ID)
+	}
+	s.compactIndex()
+	s.trashClips(evicted, ReasonEvicted, time.Now())
+}
+
+// compactIndex rebuilds the search index once removed clips dominate it
+func (s *Storage) compactIndex() {
+	if s.index.needsCompaction() {
+		s.index = buildIndex(s.backend, s.index)
+	}
+}
+
+// update writes a clip with changed metadata back, keeping the index current
+func (s *Storage) update(clip Clip) {
+	s.backend.Update(clip)
+	s.index.update(clip)
+}
+
+// backendErr returns the backend's most recent failure, if it reports them
+func (s *Storage) backendErr() error {
+	if r, ok := s.backend.(errReporter); ok {
+		return r.Err()
+	}
+	return nil
 }
 
-// Add stores a clip
+// Add stores a clip. A clip over the per-clip size limit is rejected with
+// ErrTooLarge, or cut down if it is text and truncation is on. A duplicate
+// under the dedup mode isn't stored again: the existing clip records the hit
+// and moves to the front, and its ID is returned.
 func (s *Storage) Add(clip Clip) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Add to memory
-	id, err := s.memory.Add(clip)
+	if s.maxClipSize > 0 && clip.Size() > s.maxClipSize {
+		if !s.truncate || clip.Type != "text" {
+			return 0, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, clip.Size(), s.maxClipSize)
+		}
+		clip = truncateClip(clip, s.maxClipSize)
+	}
+
+	var id int64
+	var err error
+	if dup, ok := s.duplicateOf(clip); ok {
+		id = dup.ID
+		if s.dedup != DedupConsecutive { // the most recent clip is already in front
+			_, err = s.backend.Add(dup) // moves it to the front
+		}
+	} else {
+		id, err = s.backend.Add(clip)
+	}
 	if err != nil {
 		return id, err
 	}
+	if s.index.has(id) {
+		s.recordHit(id, clip.Timestamp)
+	}
+	clip.ID = id
+	s.index.touch(clip)
 
 	// Evict oldest unpinned if over limit
-	for s.memory.Count() > s.maxMemory {
-		if !s.memory.EvictOldest() {
-			break // all remaining clips are pinned
-		}
+	s.evictOverflow()
+
+	return id, s.backendErr()
+}
+
+// SetMaxMemory changes the clip limit, evicting oldest unpinned clips if it shrank
+func (s *Storage) SetMaxMemory(maxMemory int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxMemory = maxMemory
+	s.evictOverflow()
+	return s.backendErr()
+}
+
+// SetSizeLimits sets the total byte budget and the per-clip maximum (0 for
+// no limit), evicting oldest unpinned clips if over the new budget. With
+// truncate, oversize text clips are cut down instead of rejected.
+func (s *Storage) SetSizeLimits(maxBytes, maxClipSize int64, truncate bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxBytes = maxBytes
+	s.maxClipSize = maxClipSize
+	s.truncate = truncate
+	s.evictOverflow()
+	return s.backendErr()
+}
+
+// Stats reports the number and total size of the stored clips
+func (s *Storage) Stats() (Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := Stats{
+		Clips:       s.backend.Count(),
+		Bytes:       s.backend.Bytes(),
+		MaxClips:    s.maxMemory,
+		MaxBytes:    s.maxBytes,
+		MaxClipSize: s.maxClipSize,
 	}
+	s.backend.Each(func(clip Clip) bool {
+		if clip.Pinned {
+			stats.Pinned++
+		}
+		return true
+	})
+	return stats, s.backendErr()
+}
 
-	return id, nil
+// truncateClip fits a text clip into max bytes: its extra formats go first,
+// then the text is cut at a character boundary
+func truncateClip(clip Clip, max int64) Clip {
+	clip.Formats = nil
+	if int64(len(clip.Content)) <= max {
+		return clip
+	}
+	cut := int(max)
+	for cut > 0 && !utf8.RuneStart(clip.Content[cut]) {
+		cut--
+	}
+	clip.Content = clip.Content[:cut]
+	return clip
 }
 
 // Get retrieves a clip by ID
@@ -47,7 +229,7 @@ func (s *Storage) Get(id int64) (Clip, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	clip, exists := s.memory.Get(id)
+	clip, exists := s.backend.Get(id)
 	if !exists {
 		return Clip{}, fmt.Errorf("clip %d not found", id)
 	}
@@ -59,7 +241,7 @@ func (s *Storage) List(limit int) ([]Clip, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.memory.List(limit), nil
+	return s.backend.List(limit), s.backendErr()
 }
 
 // Pin stores a clip permanently (moves to pinned list)
@@ -68,15 +250,15 @@ func (s *Storage) Pin(id int64) error {
 	defer s.mu.Unlock()
 
 	// Get from memory
-	clip, exists := s.memory.Get(id)
+	clip, exists := s.backend.Get(id)
 	if !exists {
 		return fmt.Errorf("clip %d not found", id)
 	}
 
 	// Mark as pinned and persist
 	clip.Pinned = true
-	s.memory.Update(clip)
-	return nil
+	s.update(clip)
+	return s.backendErr()
 }
 
 // Unpin removes pin status
@@ -85,55 +267,217 @@ func (s *Storage) Unpin(id int64) error {
 	defer s.mu.Unlock()
 
 	// Get from memory
-	clip, exists := s.memory.Get(id)
+	clip, exists := s.backend.Get(id)
 	if !exists {
 		return fmt.Errorf("clip %d not found", id)
 	}
 
 	// Unpin and persist
 	clip.Pinned = false
-	s.memory.Update(clip)
-	return nil
+	s.update(clip)
+	return s.backendErr()
+}
+
+// SetSensitive marks or unmarks a clip as sensitive
+func (s *Storage) SetSensitive(id int64, sensitive bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clip, exists := s.backend.Get(id)
+	if !exists {
+		return fmt.Errorf("clip %d not found", id)
+	}
+
+	clip.Sensitive = sensitive
+	s.update(clip)
+	return s.backendErr()
+}
+
+// Search returns up to limit clips matching query, best first. Words match
+// fuzzily (smart-case: case-sensitive only with an upper-case letter) and
+// filters narrow the results; see Query. Ranking blends how well the words
+// match with recency and pin status. A bad query yields a *QueryError.
+func (s *Storage) Search(query string, limit int) ([]Match, error) {
+	return s.SearchSorted(query, limit, SortRelevance)
 }
 
-// Search clips by content
-func (s *Storage) Search(query string, limit int) ([]Clip, error) {
+// SearchSorted is Search with the matches in another order; equally placed
+// matches stay in relevance order
+func (s *Storage) SearchSorted(query string, limit int, order SortOrder) ([]Match, error) {
+	now := time.Now()
+	q, err := ParseQuery(query, now)
+	if err != nil {
+		return nil, err
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Get all clips
-	clips := s.memory.List(1000) // Get all clips
+	// Ranked by relevance, clips containing the words as they are come first;
+	// the fuzzy matches are only looked for if those are too few
+	verbatim := order == SortRelevance && len(q.terms) > 0
+	matches, narrowed := s.findMatches(q, verbatim, limit, order, now)
+	if verbatim && narrowed && len(matches) < limit {
+		matches, _ = s.findMatches(q, false, limit, order, now)
+	}
+	for i := range matches {
+		_, matches[i].Positions = q.score(matches[i].Content)
+	}
+	return matches, s.backendErr()
+}
 
-	// Filter by search query
-	var results []Clip
-	for _, clip := range clips {
-		if len(results) >= limit {
-			break
+// findMatches returns the best limit matches of q in order among the index's
+// candidates for it, reporting true, or else among every clip. The caller
+// holds s.mu.
+func (s *Storage) findMatches(q Query, verbatim bool, limit int, order SortOrder, now time.Time) ([]Match, bool) {
+	var matches []Match
+	keepBest := func() {
+		rankMatches(matches, order, now)
+		if len(matches) > limit {
+			matches = matches[:limit]
+		}
+	}
+	consider := func(clip Clip) {
+		score, ok := q.matchScore(clip)
+		if !ok {
+			return
+		}
+		age := s.index.age(clip.ID)
+		matches = append(matches, Match{Clip: clip, Score: rank(score, age, clip.Pinned), age: age})
+		// Ranking every match would hold them all; only the best are needed
+		if len(matches) >= 2*limit+64 {
+			keepBest()
 		}
-		if strings.Contains(clip.Content, query) {
-			results = append(results, clip)
+	}
+	narrowed := false
+	if ids, ok := s.index.candidates(q.root, verbatim); ok {
+		for _, id := range ids {
+			if clip, exists := s.backend.Get(id); exists {
+				consider(clip)
+			}
 		}
+		narrowed = true
+	} else {
+		s.backend.Each(func(clip Clip) bool {
+			consider(clip)
+			return true
+		})
 	}
+	keepBest()
+	return matches, narrowed
+}
 
-	return results, nil
+// rankMatches sorts matches by relevance, equally ranked clips in recency
+// order, and then by order
+func rankMatches(matches []Match, order SortOrder, now time.Time) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].age < matches[j].age
+	})
+	sortMatches(matches, order, now)
 }
 
-// Remove removes a clip
+// Remove moves a clip to the trash
 func (s *Storage) Remove(id int64) error {
+	_, err := s.RemoveIDs([]int64{id})
+	return err
+}
+
+// RemoveIDs moves the given clips to the trash and returns the IDs of those
+// that existed
+func (s *Storage) RemoveIDs(ids []int64) ([]int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.memory.Remove(id)
-	return nil
+	var removed []int64
+	var clips []Clip
+	for _, id := range ids {
+		if clip, exists := s.backend.Get(id); exists && s.backend.Remove(id) {
+			removed = append(removed, id)
+			clips = append(clips, clip)
+			s.index.remove(id)
+		}
+	}
+	s.compactIndex()
+	s.trashClips(clips, ReasonDeleted, time.Now())
+	return removed, s.backendErr()
+}
+
+// RemoveMatching moves every clip the search query selects, pinned or not,
+// to the trash and returns their IDs
+func (s *Storage) RemoveMatching(query string) ([]int64, error) {
+	q, err := ParseQuery(query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.removeWhere(q.Match, ReasonDeleted)
 }
 
-// Clear removes all clips
-func (s *Storage) Clear() error {
+// removeWhere removes every clip for which match returns true and returns
+// their IDs. The clips go to the trash as one removal unless reason is empty.
+func (s *Storage) removeWhere(match func(Clip) bool, reason string) ([]int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.memory.Clear()
-	return nil
+	var ids []int64
+	var clips []Clip
+	s.backend.Each(func(clip Clip) bool {
+		if match(clip) {
+			ids = append(ids, clip.ID)
+			clips = append(clips, clip)
+		}
+		return true
+	})
+	for _, id := range ids {
+		s.backend.Remove(id)
+		s.index.remove(id)
+	}
+	s.compactIndex()
+	if reason != "" {
+		// Oldest first, so the most recent clips survive trimming and
+		// come back most recent on undo
+		for i, j := 0, len(clips)-1; i < j; i, j = i+1, j-1 {
+			clips[i], clips[j] = clips[j], clips[i]
+		}
+		s.trashClips(clips, reason, time.Now())
+	}
+	return ids, s.backendErr()
+}
+
+// SetExpiry gives a clip a time to live, pinned or not; the zero time removes it
+func (s *Storage) SetExpiry(id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clip, exists := s.backend.Get(id)
+	if !exists {
+		return fmt.Errorf("clip %d not found", id)
+	}
+
+	clip.ExpiresAt = at
+	s.update(clip)
+	return s.backendErr()
+}
+
+// RemoveExpired removes the clips that expired by now and returns their IDs;
+// they skip the trash. A clip's own ExpiresAt always applies; other unpinned
+// clips expire maxAge after they were captured (never when maxAge is 0).
+func (s *Storage) RemoveExpired(now time.Time, maxAge time.Duration) ([]int64, error) {
+	return s.removeWhere(func(clip Clip) bool {
+		expiresAt := clip.ExpiresAt
+		if expiresAt.IsZero() && !clip.Pinned && maxAge > 0 {
+			expiresAt = clip.Timestamp.Add(maxAge)
+		}
+		return !expiresAt.IsZero() && !expiresAt.After(now)
+	}, "")
+}
+
+// Clear moves all clips, or only the unpinned ones with keepPinned, to the
+// trash and returns the IDs it removed
+func (s *Storage) Clear(keepPinned bool) ([]int64, error) {
+	return s.removeWhere(func(clip Clip) bool { return !keepPinned || !clip.Pinned }, ReasonCleared)
 }
 
 // GetPinned returns only pinned clips
@@ -141,21 +485,20 @@ func (s *Storage) GetPinned() ([]Clip, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Get all clips
-	clips := s.memory.List(1000)
-
-	// Filter by pinned
 	var pinned []Clip
-	for _, clip := range clips {
-		if clip.Pinned {
+	for _, id := range s.index.pinnedIDs() {
+		if clip, exists := s.backend.Get(id); exists {
 			pinned = append(pinned, clip)
 		}
 	}
 
-	return pinned, nil
+	return pinned, s.backendErr()
 }
 
-// Close closes storage (no-op for memory-only)
+// Close closes the backend if it holds resources (no-op for memory-only)
 func (s *Storage) Close() error {
+	if c, ok := s.backend.(io.Closer); ok {
+		return c.Close()
+	}
 	return nil
 }
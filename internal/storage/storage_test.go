@@ -1,277 +1,1278 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
-func setupTestStorage() (*Storage, func()) {
-	store, _ := NewStorage(5)
-	cleanup := func() {
-		store.Close()
-	}
-	return store, cleanup
+// testBackends lists the storage configurations every Storage test runs against
+var testBackends = []struct {
+	name string
+	open func(t *testing.T) (*Storage, error)
+}{
+	{"memory", func(t *testing.T) (*Storage, error) {
+		return NewStorage(5)
+	}},
+	{"sqlite", func(t *testing.T) (*Storage, error) {
+		disk, err := NewSQLiteStore(filepath.Join(t.TempDir(), "clipnest.db"))
+		if err != nil {
+			return nil, err
+		}
+		return NewStorageWithBackend(disk, 5)
+	}},
+	{"tiered", func(t *testing.T) (*Storage, error) {
+		// Hot tier smaller than the limit so both tiers are exercised
+		return OpenStorage(5, filepath.Join(t.TempDir(), "clipnest.db"), 2)
+	}},
 }
 
-func TestStorage_Add(t *testing.T) {
-	store, cleanup := setupTestStorage()
-	defer cleanup()
+// forEachBackend runs fn as a subtest against a fresh Storage for every backend
+func forEachBackend(t *testing.T, fn func(t *testing.T, store *Storage)) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store, err := backend.open(t)
+			if err != nil {
+				t.Fatalf("Failed to open storage: %v", err)
+			}
+			defer store.Close()
 
-	clip := Clip{
-		Content:   "test content",
-		Type:      "text",
-		Timestamp: time.Now(),
+			fn(t, store)
+		})
 	}
+}
 
-	id, err := store.Add(clip)
-	if err != nil {
-		t.Fatalf("Failed to add clip: %v", err)
-	}
+func TestStorage_Add(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		clip := Clip{
+			Content:   "test content",
+			Type:      "text",
+			Timestamp: time.Now(),
+		}
 
-	if id == 0 {
-		t.Fatal("Expected non-zero ID")
-	}
+		id, err := store.Add(clip)
+		if err != nil {
+			t.Fatalf("Failed to add clip: %v", err)
+		}
 
-	// Verify clip exists
-	retrieved, err := store.Get(id)
-	if err != nil {
-		t.Fatalf("Failed to get clip: %v", err)
-	}
+		if id == 0 {
+			t.Fatal("Expected non-zero ID")
+		}
 
-	if retrieved.Content != clip.Content {
-		t.Fatalf("Expected content %s, got %s", clip.Content, retrieved.Content)
-	}
+		// Verify clip exists
+		retrieved, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("Failed to get clip: %v", err)
+		}
+
+		if retrieved.Content != clip.Content {
+			t.Fatalf("Expected content %s, got %s", clip.Content, retrieved.Content)
+		}
+	})
 }
 
 func TestStorage_Pin(t *testing.T) {
-	store, cleanup := setupTestStorage()
-	defer cleanup()
-
-	// Add unpinned clip
-	clip := Clip{
-		Content:   "test content",
-		Type:      "text",
-		Timestamp: time.Now(),
-		Pinned:    false,
-	}
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		// Add unpinned clip
+		clip := Clip{
+			Content:   "test content",
+			Type:      "text",
+			Timestamp: time.Now(),
+			Pinned:    false,
+		}
 
-	id, _ := store.Add(clip)
+		id, _ := store.Add(clip)
 
-	// Pin it
-	err := store.Pin(id)
-	if err != nil {
-		t.Fatalf("Failed to pin clip: %v", err)
-	}
+		// Pin it
+		err := store.Pin(id)
+		if err != nil {
+			t.Fatalf("Failed to pin clip: %v", err)
+		}
 
-	// Verify it's marked as pinned
-	retrieved, _ := store.Get(id)
-	if !retrieved.Pinned {
-		t.Fatal("Expected clip to be pinned")
-	}
+		// Verify it's marked as pinned
+		retrieved, _ := store.Get(id)
+		if !retrieved.Pinned {
+			t.Fatal("Expected clip to be pinned")
+		}
+	})
 }
 
 func TestStorage_Unpin(t *testing.T) {
-	store, cleanup := setupTestStorage()
-	defer cleanup()
-
-	// Add a pinned clip
-	clip := Clip{
-		Content:   "test content",
-		Type:      "text",
-		Timestamp: time.Now(),
-		Pinned:    true,
-	}
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		// Add a pinned clip
+		clip := Clip{
+			Content:   "test content",
+			Type:      "text",
+			Timestamp: time.Now(),
+			Pinned:    true,
+		}
 
-	id, _ := store.Add(clip)
+		id, _ := store.Add(clip)
 
-	// Verify it's pinned
-	retrieved, _ := store.Get(id)
-	if !retrieved.Pinned {
-		t.Fatal("Expected clip to be pinned")
-	}
+		// Verify it's pinned
+		retrieved, _ := store.Get(id)
+		if !retrieved.Pinned {
+			t.Fatal("Expected clip to be pinned")
+		}
 
-	// Unpin it
-	err := store.Unpin(id)
-	if err != nil {
-		t.Fatalf("Failed to unpin clip: %v", err)
-	}
+		// Unpin it
+		err := store.Unpin(id)
+		if err != nil {
+			t.Fatalf("Failed to unpin clip: %v", err)
+		}
 
-	// Verify it's unpinned
-	retrieved, _ = store.Get(id)
-	if retrieved.Pinned {
-		t.Fatal("Expected clip to be unpinned")
-	}
+		// Verify it's unpinned
+		retrieved, _ = store.Get(id)
+		if retrieved.Pinned {
+			t.Fatal("Expected clip to be unpinned")
+		}
+	})
 }
 
 func TestStorage_List(t *testing.T) {
-	store, cleanup := setupTestStorage()
-	defer cleanup()
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		// Add multiple clips
+		for i := 0; i < 3; i++ {
+			clip := Clip{
+				Content:   "content " + string(rune('a'+i)),
+				Type:      "text",
+				Timestamp: time.Now(),
+				Pinned:    i == 0, // First one pinned
+			}
+			store.Add(clip)
+		}
 
-	// Add multiple clips
-	for i := 0; i < 3; i++ {
+		clips, err := store.List(10)
+		if err != nil {
+			t.Fatalf("Failed to list clips: %v", err)
+		}
+
+		if len(clips) != 3 {
+			t.Fatalf("Expected 3 clips, got %d", len(clips))
+		}
+
+		// Verify at least one clip is pinned
+		pinnedCount := 0
+		for _, clip := range clips {
+			if clip.Pinned {
+				pinnedCount++
+			}
+		}
+
+		if pinnedCount < 1 {
+			t.Fatal("Expected at least one pinned clip")
+		}
+	})
+}
+
+func TestStorage_Search(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		// Add clips with different content
+		clips := []Clip{
+			{Content: "api_key_123", Type: "text", Timestamp: time.Now(), Pinned: true},
+			{Content: "database_url", Type: "text", Timestamp: time.Now(), Pinned: false},
+			{Content: "another value", Type: "text", Timestamp: time.Now(), Pinned: false},
+		}
+
+		for _, clip := range clips {
+			store.Add(clip)
+		}
+
+		// Search for "api"
+		results, err := store.Search("api", 10)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+
+		if len(results) == 0 {
+			t.Fatal("Expected search results")
+		}
+
+		// Should find "api_key_123"
+		found := false
+		for _, result := range results {
+			if result.Content == "api_key_123" {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Fatal("Search didn't find 'api_key_123'")
+		}
+	})
+}
+
+func TestStorage_Remove(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
 		clip := Clip{
-			Content:   "content " + string(rune('a'+i)),
+			Content:   "test content",
 			Type:      "text",
 			Timestamp: time.Now(),
-			Pinned:    i == 0, // First one pinned
+			Pinned:    true,
+		}
+
+		id, _ := store.Add(clip)
+
+		err := store.Remove(id)
+		if err != nil {
+			t.Fatalf("Failed to remove clip: %v", err)
+		}
+
+		// Verify it's gone
+		_, err = store.Get(id)
+		if err == nil {
+			t.Fatal("Clip still exists after removal")
+		}
+	})
+}
+
+func TestStorage_Clear(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		// Add clips
+		for i := 0; i < 5; i++ {
+			clip := Clip{
+				Content:   "content " + string(rune('a'+i)),
+				Type:      "text",
+				Timestamp: time.Now(),
+				Pinned:    i < 2, // First 2 pinned
+			}
+			store.Add(clip)
+		}
+
+		// Clear all
+		removed, err := store.Clear(false)
+		if err != nil {
+			t.Fatalf("Failed to clear storage: %v", err)
+		}
+		if len(removed) != 5 {
+			t.Fatalf("Expected 5 removed IDs, got %v", removed)
+		}
+
+		// Verify everything is gone
+		clips, err := store.List(10)
+		if err != nil {
+			t.Fatalf("Failed to list clips: %v", err)
+		}
+
+		if len(clips) != 0 {
+			t.Fatalf("Expected 0 clips after clear, got %d", len(clips))
+		}
+
+		pinned, _ := store.GetPinned()
+		if len(pinned) != 0 {
+			t.Fatalf("Expected 0 pinned clips after clear, got %d", len(pinned))
+		}
+	})
+}
+
+func TestStorage_ClearKeepPinned(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		var pinnedID int64
+		for i := 0; i < 3; i++ {
+			id, _ := store.Add(Clip{Content: "content " + string(rune('a'+i)), Type: "text", Timestamp: time.Now()})
+			if i == 1 {
+				pinnedID = id
+				store.Pin(id)
+			}
+		}
+
+		removed, err := store.Clear(true)
+		if err != nil {
+			t.Fatalf("Failed to clear storage: %v", err)
+		}
+		if len(removed) != 2 {
+			t.Fatalf("Expected 2 removed IDs, got %v", removed)
+		}
+
+		clips, _ := store.List(10)
+		if len(clips) != 1 || clips[0].ID != pinnedID {
+			t.Fatalf("Expected only pinned clip %d to remain, got %+v", pinnedID, clips)
+		}
+	})
+}
+
+func TestStorage_RemoveIDs(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		id1, _ := store.Add(Clip{Content: "one", Type: "text", Timestamp: time.Now()})
+		id2, _ := store.Add(Clip{Content: "two", Type: "text", Timestamp: time.Now()})
+		id3, _ := store.Add(Clip{Content: "three", Type: "text", Timestamp: time.Now()})
+
+		removed, err := store.RemoveIDs([]int64{id1, id3, 999})
+		if err != nil {
+			t.Fatalf("Failed to remove clips: %v", err)
+		}
+		if len(removed) != 2 || removed[0] != id1 || removed[1] != id3 {
+			t.Fatalf("Expected [%d %d] removed, got %v", id1, id3, removed)
+		}
+
+		clips, _ := store.List(10)
+		if len(clips) != 1 || clips[0].ID != id2 {
+			t.Fatalf("Expected only clip %d to remain, got %+v", id2, clips)
+		}
+	})
+}
+
+func TestStorage_RemoveMatching(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		store.Add(Clip{Content: "api key one", Type: "text", Timestamp: time.Now()})
+		keep, _ := store.Add(Clip{Content: "hello", Type: "text", Timestamp: time.Now()})
+		pinned, _ := store.Add(Clip{Content: "api key two", Type: "text", Timestamp: time.Now()})
+		store.Pin(pinned)
+
+		removed, err := store.RemoveMatching("api")
+		if err != nil {
+			t.Fatalf("Failed to remove clips: %v", err)
+		}
+		if len(removed) != 2 {
+			t.Fatalf("Expected 2 removed IDs, got %v", removed)
+		}
+
+		clips, _ := store.List(10)
+		if len(clips) != 1 || clips[0].ID != keep {
+			t.Fatalf("Expected only clip %d to remain, got %+v", keep, clips)
+		}
+
+		// The query language applies, as in search
+		store.Add(Clip{Content: "hello again", Type: "text", Timestamp: time.Now()})
+		removed, err = store.RemoveMatching(`"hello" -again`)
+		if err != nil {
+			t.Fatalf("Failed to remove clips: %v", err)
+		}
+		if len(removed) != 1 || removed[0] != keep {
+			t.Fatalf("Expected only clip %d removed, got %v", keep, removed)
+		}
+
+		var qerr *QueryError
+		if _, err := store.RemoveMatching("(hello"); !errors.As(err, &qerr) {
+			t.Fatalf("Expected a QueryError, got %v", err)
+		}
+		if clips, _ := store.List(10); len(clips) != 1 {
+			t.Fatalf("Expected a bad query to remove nothing, got %+v", clips)
+		}
+	})
+}
+
+func TestStorage_MemoryEviction(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		// Add 5 clips (exceeds memory limit of 5)
+		for i := 0; i < 5; i++ {
+			clip := Clip{
+				Content:   "content " + string(rune('a'+i)),
+				Type:      "text",
+				Timestamp: time.Now(),
+				Pinned:    false,
+			}
+			store.Add(clip)
+		}
+
+		// Add one more clip
+		clip := Clip{
+			Content:   "extra content",
+			Type:      "text",
+			Timestamp: time.Now(),
+			Pinned:    false,
 		}
 		store.Add(clip)
+
+		// Only last 5 should remain
+		clips, err := store.List(10)
+		if err != nil {
+			t.Fatalf("Failed to list clips: %v", err)
+		}
+
+		if len(clips) != 5 {
+			t.Fatalf("Expected 5 clips (memory limit), got %d", len(clips))
+		}
+	})
+}
+
+func TestStorage_PersistsAcrossReopen(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "clipnest.db")
+
+	store, err := OpenStorage(5, dbPath, 5)
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+
+	ts := time.Now()
+	pinnedID, _ := store.Add(Clip{Content: "pinned snippet", Type: "text", Timestamp: ts})
+	store.Add(Clip{Content: "older", Type: "text", Timestamp: ts})
+	store.Add(Clip{Content: "newest", Type: "text", Timestamp: ts})
+	if err := store.Pin(pinnedID); err != nil {
+		t.Fatalf("Failed to pin clip: %v", err)
 	}
+	store.Close()
 
-	clips, err := store.List(10)
+	store, err = OpenStorage(5, dbPath, 5)
 	if err != nil {
-		t.Fatalf("Failed to list clips: %v", err)
+		t.Fatalf("Failed to reopen storage: %v", err)
 	}
+	defer store.Close()
 
+	clips, _ := store.List(10)
 	if len(clips) != 3 {
-		t.Fatalf("Expected 3 clips, got %d", len(clips))
+		t.Fatalf("Expected 3 clips after reopen, got %d", len(clips))
 	}
 
-	// Verify at least one clip is pinned
-	pinnedCount := 0
-	for _, clip := range clips {
-		if clip.Pinned {
-			pinnedCount++
+	// Recency order is preserved (most recent first)
+	want := []string{"newest", "older", "pinned snippet"}
+	for i, c := range clips {
+		if c.Content != want[i] {
+			t.Fatalf("Expected clip %d to be %q, got %q", i, want[i], c.Content)
 		}
 	}
 
-	if pinnedCount < 1 {
-		t.Fatal("Expected at least one pinned clip")
+	retrieved, err := store.Get(pinnedID)
+	if err != nil {
+		t.Fatalf("Failed to get pinned clip: %v", err)
+	}
+	if !retrieved.Pinned {
+		t.Fatal("Expected clip to still be pinned after reopen")
+	}
+	if !retrieved.Timestamp.Equal(ts) {
+		t.Fatalf("Expected timestamp %v, got %v", ts, retrieved.Timestamp)
+	}
+
+	// IDs keep counting from where the previous run left off
+	id, _ := store.Add(Clip{Content: "after reopen", Type: "text", Timestamp: time.Now()})
+	if id != 4 {
+		t.Fatalf("Expected next ID 4, got %d", id)
 	}
 }
 
-func TestStorage_Search(t *testing.T) {
-	store, cleanup := setupTestStorage()
-	defer cleanup()
-
-	// Add clips with different content
-	clips := []Clip{
-		{Content: "api_key_123", Type: "text", Timestamp: time.Now(), Pinned: true},
-		{Content: "database_url", Type: "text", Timestamp: time.Now(), Pinned: false},
-		{Content: "another value", Type: "text", Timestamp: time.Now(), Pinned: false},
+func TestStorage_ReopenWithSmallerLimit(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "clipnest.db")
+
+	store, err := OpenStorage(5, dbPath, 5)
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		store.Add(Clip{Content: "content " + string(rune('a'+i)), Type: "text", Timestamp: time.Now()})
 	}
+	store.Close()
 
-	for _, clip := range clips {
-		store.Add(clip)
+	store, err = OpenStorage(2, dbPath, 2)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
 	}
+	store.Close()
 
-	// Search for "api"
-	results, err := store.Search("api", 10)
+	// Evictions on load are written through as well
+	store, err = OpenStorage(5, dbPath, 5)
 	if err != nil {
-		t.Fatalf("Failed to search: %v", err)
+		t.Fatalf("Failed to reopen storage: %v", err)
 	}
+	defer store.Close()
 
-	if len(results) == 0 {
-		t.Fatal("Expected search results")
+	clips, _ := store.List(10)
+	if len(clips) != 2 {
+		t.Fatalf("Expected 2 clips after shrinking the limit, got %d", len(clips))
 	}
+}
 
-	// Should find "api_key_123"
-	found := false
-	for _, result := range results {
-		if result.Content == "api_key_123" {
-			found = true
-			break
+func TestStorage_SetMaxMemory(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		for i := 0; i < 5; i++ {
+			store.Add(Clip{
+				Content:   "content " + string(rune('a'+i)),
+				Type:      "text",
+				Timestamp: time.Now(),
+				Pinned:    i == 0, // oldest is pinned
+			})
 		}
-	}
 
-	if !found {
-		t.Fatal("Search didn't find 'api_key_123'")
-	}
+		if err := store.SetMaxMemory(2); err != nil {
+			t.Fatalf("Failed to shrink limit: %v", err)
+		}
+
+		// The pinned clip survives alongside the most recent one
+		clips, _ := store.List(10)
+		if len(clips) != 2 {
+			t.Fatalf("Expected 2 clips after shrinking, got %d", len(clips))
+		}
+		if clips[0].Content != "content e" || clips[1].Content != "content a" {
+			t.Fatalf("Expected [content e, content a], got [%s, %s]", clips[0].Content, clips[1].Content)
+		}
+	})
 }
 
-func TestStorage_Remove(t *testing.T) {
-	store, cleanup := setupTestStorage()
-	defer cleanup()
-
-	clip := Clip{
-		Content:   "test content",
-		Type:      "text",
-		Timestamp: time.Now(),
-		Pinned:    true,
-	}
+func TestStorage_ImageClips(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		png := []byte("\x89PNG fake image data")
+		image := Clip{
+			Type:      "image",
+			Timestamp: time.Now(),
+			Data:      png,
+			Width:     640,
+			Height:    480,
+			Hash:      "hash-a",
+			Thumbnail: []byte("thumb"),
+		}
 
-	id, _ := store.Add(clip)
+		id, err := store.Add(image)
+		if err != nil {
+			t.Fatalf("Failed to add image: %v", err)
+		}
 
-	err := store.Remove(id)
-	if err != nil {
-		t.Fatalf("Failed to remove clip: %v", err)
-	}
+		// Same hash deduplicates even though Content is empty
+		dup, _ := store.Add(image)
+		if dup != id {
+			t.Fatalf("Expected duplicate image to keep ID %d, got %d", id, dup)
+		}
 
-	// Verify it's gone
-	_, err = store.Get(id)
-	if err == nil {
-		t.Fatal("Clip still exists after removal")
-	}
-}
+		// A different image with the same (empty) content is a new clip
+		other := image
+		other.Hash = "hash-b"
+		otherID, _ := store.Add(other)
+		if otherID == id {
+			t.Fatal("Expected a different image to get a new ID")
+		}
 
-func TestStorage_Clear(t *testing.T) {
-	store, cleanup := setupTestStorage()
-	defer cleanup()
+		retrieved, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("Failed to get image: %v", err)
+		}
+		if string(retrieved.Data) != string(png) || retrieved.Width != 640 || retrieved.Height != 480 {
+			t.Fatalf("Image not stored intact: %+v", retrieved)
+		}
+		if string(retrieved.Thumbnail) != "thumb" {
+			t.Fatalf("Expected thumbnail to be stored, got %q", retrieved.Thumbnail)
+		}
+	})
+}
 
-	// Add clips
-	for i := 0; i < 5; i++ {
+func TestStorage_Formats(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
 		clip := Clip{
-			Content:   "content " + string(rune('a'+i)),
+			Content:   "hello",
 			Type:      "text",
 			Timestamp: time.Now(),
-			Pinned:    i < 2, // First 2 pinned
+			Formats:   map[string][]byte{"text/html": []byte("<b>hello</b>")},
 		}
-		store.Add(clip)
-	}
 
-	// Clear all
-	err := store.Clear()
-	if err != nil {
-		t.Fatalf("Failed to clear storage: %v", err)
-	}
+		id, err := store.Add(clip)
+		if err != nil {
+			t.Fatalf("Failed to add clip: %v", err)
+		}
 
-	// Verify everything is gone
-	clips, err := store.List(10)
-	if err != nil {
-		t.Fatalf("Failed to list clips: %v", err)
+		// Dedup only looks at the plain text
+		plain := Clip{Content: "hello", Type: "text", Timestamp: time.Now()}
+		dup, _ := store.Add(plain)
+		if dup != id {
+			t.Fatalf("Expected same text with different formats to keep ID %d, got %d", id, dup)
+		}
+
+		retrieved, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("Failed to get clip: %v", err)
+		}
+		if string(retrieved.Formats["text/html"]) != "<b>hello</b>" {
+			t.Fatalf("Expected HTML format to be stored, got %q", retrieved.Formats)
+		}
+	})
+}
+
+func TestStorage_FileClips(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		clip := Clip{
+			Content:   "/tmp/a.txt\n/tmp/gone",
+			Type:      "files",
+			Timestamp: time.Now(),
+			Files: []File{
+				{Path: "/tmp/a.txt", Exists: true, Size: 42},
+				{Path: "/tmp/gone"},
+			},
+		}
+
+		id, err := store.Add(clip)
+		if err != nil {
+			t.Fatalf("Failed to add file clip: %v", err)
+		}
+
+		// The same paths copied as text are a different clip
+		textID, _ := store.Add(Clip{Content: clip.Content, Type: "text", Timestamp: time.Now()})
+		if textID == id {
+			t.Fatal("Expected text with the same content to get a new ID")
+		}
+
+		retrieved, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("Failed to get file clip: %v", err)
+		}
+		if len(retrieved.Files) != 2 || retrieved.Files[0] != clip.Files[0] || retrieved.Files[1] != clip.Files[1] {
+			t.Fatalf("File list not stored intact: %+v", retrieved.Files)
+		}
+	})
+}
+
+func TestStorage_Source(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		id, err := store.Add(Clip{Content: "selected", Type: "text", Timestamp: time.Now(), Source: "primary"})
+		if err != nil {
+			t.Fatalf("Failed to add clip: %v", err)
+		}
+
+		// The same text copied later keeps the clip (and its original source)
+		dup, _ := store.Add(Clip{Content: "selected", Type: "text", Timestamp: time.Now(), Source: "clipboard"})
+		if dup != id {
+			t.Fatalf("Expected duplicate to keep ID %d, got %d", id, dup)
+		}
+
+		retrieved, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("Failed to get clip: %v", err)
+		}
+		if retrieved.Source != "primary" {
+			t.Fatalf("Expected source primary, got %q", retrieved.Source)
+		}
+	})
+}
+
+func TestStorage_RemoveExpired(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		now := time.Now()
+		keep, _ := store.Add(Clip{Content: "keep", Type: "text", Timestamp: now})
+		later, _ := store.Add(Clip{Content: "later", Type: "text", Timestamp: now, ExpiresAt: now.Add(time.Hour)})
+		gone, _ := store.Add(Clip{Content: "gone", Type: "text", Timestamp: now, ExpiresAt: now.Add(time.Minute), Pinned: true})
+
+		retrieved, err := store.Get(later)
+		if err != nil {
+			t.Fatalf("Failed to get clip: %v", err)
+		}
+		if !retrieved.ExpiresAt.Equal(now.Add(time.Hour)) {
+			t.Fatalf("Expected expiry %v, got %v", now.Add(time.Hour), retrieved.ExpiresAt)
+		}
+
+		// Expiry applies to pinned clips too
+		removed, err := store.RemoveExpired(now.Add(2*time.Minute), 0)
+		if err != nil {
+			t.Fatalf("Failed to remove expired clips: %v", err)
+		}
+		if len(removed) != 1 || removed[0] != gone {
+			t.Fatalf("Expected only clip %d removed, got %v", gone, removed)
+		}
+		if _, err := store.Get(gone); err == nil {
+			t.Fatal("Expected expired clip to be gone")
+		}
+		for _, id := range []int64{keep, later} {
+			if _, err := store.Get(id); err != nil {
+				t.Fatalf("Expected clip %d to remain: %v", id, err)
+			}
+		}
+	})
+}
+
+func TestStorage_SetSensitive(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		id, _ := store.Add(Clip{Content: "hunter2", Type: "text", Timestamp: time.Now()})
+
+		if err := store.SetSensitive(id, true); err != nil {
+			t.Fatalf("Failed to mark clip sensitive: %v", err)
+		}
+		retrieved, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("Failed to get clip: %v", err)
+		}
+		if !retrieved.Sensitive {
+			t.Fatal("Expected clip to be sensitive")
+		}
+
+		if err := store.SetSensitive(id, false); err != nil {
+			t.Fatalf("Failed to unmark clip: %v", err)
+		}
+		if retrieved, _ := store.Get(id); retrieved.Sensitive {
+			t.Fatal("Expected clip not to be sensitive")
+		}
+
+		if err := store.SetSensitive(999, true); err == nil {
+			t.Fatal("Expected error for a missing clip")
+		}
+	})
+}
+
+func TestStorage_RemoveExpired_MaxAge(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		now := time.Now()
+		old, _ := store.Add(Clip{Content: "old", Type: "text", Timestamp: now.Add(-48 * time.Hour)})
+		recent, _ := store.Add(Clip{Content: "recent", Type: "text", Timestamp: now.Add(-time.Hour)})
+		pinned, _ := store.Add(Clip{Content: "pinned", Type: "text", Timestamp: now.Add(-48 * time.Hour), Pinned: true})
+		kept, _ := store.Add(Clip{Content: "kept", Type: "text", Timestamp: now.Add(-48 * time.Hour)})
+		pinnedTTL, _ := store.Add(Clip{Content: "pinned ttl", Type: "text", Timestamp: now.Add(-48 * time.Hour), Pinned: true})
+
+		// An explicit ttl overrides the retention in both directions
+		if err := store.SetExpiry(kept, now.Add(time.Hour)); err != nil {
+			t.Fatalf("Failed to set expiry: %v", err)
+		}
+		if err := store.SetExpiry(pinnedTTL, now.Add(-time.Second)); err != nil {
+			t.Fatalf("Failed to set expiry: %v", err)
+		}
+		if err := store.SetExpiry(999, now); err == nil {
+			t.Fatal("Expected error for a missing clip")
+		}
+
+		removed, err := store.RemoveExpired(now, 24*time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to remove expired clips: %v", err)
+		}
+		sort.Slice(removed, func(i, j int) bool { return removed[i] < removed[j] })
+		if len(removed) != 2 || removed[0] != old || removed[1] != pinnedTTL {
+			t.Fatalf("Expected clips %d and %d removed, got %v", old, pinnedTTL, removed)
+		}
+		for _, id := range []int64{recent, pinned, kept} {
+			if _, err := store.Get(id); err != nil {
+				t.Fatalf("Expected clip %d to remain: %v", id, err)
+			}
+		}
+
+		// Clearing the ttl hands the clip back to the retention policy
+		if err := store.SetExpiry(kept, time.Time{}); err != nil {
+			t.Fatalf("Failed to clear expiry: %v", err)
+		}
+		if removed, _ := store.RemoveExpired(now, 24*time.Hour); len(removed) != 1 || removed[0] != kept {
+			t.Fatalf("Expected clip %d removed, got %v", kept, removed)
+		}
+	})
+}
+
+func TestStorage_ByteBudget(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		if err := store.SetSizeLimits(100, 0, false); err != nil {
+			t.Fatalf("Failed to set size limits: %v", err)
+		}
+
+		pinned, _ := store.Add(Clip{Content: strings.Repeat("p", 30), Type: "text", Timestamp: time.Now(), Pinned: true})
+		first, _ := store.Add(Clip{Content: strings.Repeat("a", 30), Type: "text", Timestamp: time.Now()})
+		second, _ := store.Add(Clip{Content: strings.Repeat("b", 30), Type: "text", Timestamp: time.Now()})
+
+		// 120 bytes: the oldest unpinned clip goes, though the count limit isn't reached
+		third, _ := store.Add(Clip{Content: "c", Type: "text", Timestamp: time.Now(), Formats: map[string][]byte{"text/html": []byte(strings.Repeat("c", 29))}})
+		if _, err := store.Get(first); err == nil {
+			t.Fatal("Expected the oldest unpinned clip to be evicted")
+		}
+		for _, id := range []int64{pinned, second, third} {
+			if _, err := store.Get(id); err != nil {
+				t.Fatalf("Expected clip %d to remain: %v", id, err)
+			}
+		}
+
+		stats, err := store.Stats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Clips != 3 || stats.Pinned != 1 || stats.Bytes != 90 || stats.MaxBytes != 100 {
+			t.Fatalf("Unexpected stats: %+v", stats)
+		}
+
+		// Shrinking the budget evicts right away
+		if err := store.SetSizeLimits(40, 0, false); err != nil {
+			t.Fatalf("Failed to set size limits: %v", err)
+		}
+		if stats, _ := store.Stats(); stats.Clips != 1 || stats.Bytes != 30 {
+			t.Fatalf("Expected only the pinned clip left, got %+v", stats)
+		}
+	})
+}
+
+func TestStorage_MaxClipSize(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		if err := store.SetSizeLimits(0, 10, false); err != nil {
+			t.Fatalf("Failed to set size limits: %v", err)
+		}
+		if _, err := store.Add(Clip{Content: strings.Repeat("x", 11), Type: "text", Timestamp: time.Now()}); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("Expected ErrTooLarge, got %v", err)
+		}
+		if id, err := store.Add(Clip{Content: strings.Repeat("x", 10), Type: "text", Timestamp: time.Now()}); err != nil || id == 0 {
+			t.Fatalf("Expected a clip at the limit to be stored, got %d, %v", id, err)
+		}
+
+		// Truncation drops extra formats first, then cuts the text on a rune boundary
+		if err := store.SetSizeLimits(0, 10, true); err != nil {
+			t.Fatalf("Failed to set size limits: %v", err)
+		}
+		id, err := store.Add(Clip{Content: "short", Type: "text", Timestamp: time.Now(), Formats: map[string][]byte{"text/html": []byte("<b>short</b>")}})
+		if err != nil {
+			t.Fatalf("Failed to add clip: %v", err)
+		}
+		if clip, _ := store.Get(id); clip.Content != "short" || len(clip.Formats) != 0 {
+			t.Fatalf("Expected the html dropped, got %+v", clip)
+		}
+		id, err = store.Add(Clip{Content: "ééééééé", Type: "text", Timestamp: time.Now()})
+		if err != nil {
+			t.Fatalf("Failed to add clip: %v", err)
+		}
+		if clip, _ := store.Get(id); clip.Content != "ééééé" {
+			t.Fatalf("Expected the text cut to 5 characters, got %q", clip.Content)
+		}
+
+		// Images can't be cut down
+		if _, err := store.Add(Clip{Type: "image", Data: make([]byte, 11), Hash: "h", Timestamp: time.Now()}); !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("Expected ErrTooLarge for an image, got %v", err)
+		}
+	})
+}
+
+func TestStorage_TrashRestore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		id, _ := store.Add(Clip{Content: "keep me", Type: "text", Timestamp: time.Now()})
+		store.Add(Clip{Content: "newer", Type: "text", Timestamp: time.Now()})
+		store.Pin(id)
+
+		if _, err := store.RemoveIDs([]int64{id}); err != nil {
+			t.Fatalf("Failed to remove clip: %v", err)
+		}
+		trash := store.Trash()
+		if len(trash) != 1 || trash[0].ID != id || trash[0].Reason != ReasonDeleted || trash[0].RemovedAt.IsZero() {
+			t.Fatalf("Expected clip %d in the trash as deleted, got %+v", id, trash)
+		}
+
+		restored, err := store.Restore(id)
+		if err != nil {
+			t.Fatalf("Failed to restore clip: %v", err)
+		}
+		if restored.ID != id || !restored.Pinned {
+			t.Fatalf("Expected clip %d back pinned, got %+v", id, restored)
+		}
+		if got, err := store.Get(id); err != nil || got.Content != "keep me" || !got.Pinned {
+			t.Fatalf("Expected restored clip under its old ID, got %+v, %v", got, err)
+		}
+		if len(store.Trash()) != 0 {
+			t.Fatalf("Expected an empty trash after restoring, got %+v", store.Trash())
+		}
+		if _, err := store.Restore(id); err == nil {
+			t.Fatal("Expected restoring a clip twice to fail")
+		}
+	})
+}
+
+func TestStorage_Undo(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		for _, content := range []string{"a", "b", "c"} {
+			store.Add(Clip{Content: content, Type: "text", Timestamp: time.Now()})
+		}
+		if _, err := store.Undo(); !errors.Is(err, ErrNothingToUndo) {
+			t.Fatalf("Expected ErrNothingToUndo, got %v", err)
+		}
+
+		store.RemoveMatching("a")
+		store.Clear(false)
+
+		// Undo brings back the clear, in the original order, but not the delete
+		restored, err := store.Undo()
+		if err != nil {
+			t.Fatalf("Failed to undo: %v", err)
+		}
+		if len(restored) != 2 {
+			t.Fatalf("Expected 2 restored clips, got %+v", restored)
+		}
+		clips, _ := store.List(10)
+		if len(clips) != 2 || clips[0].Content != "c" || clips[1].Content != "b" {
+			t.Fatalf("Expected [c b] after undo, got %+v", clips)
+		}
+
+		restored, _ = store.Undo()
+		if len(restored) != 1 || restored[0].Content != "a" {
+			t.Fatalf("Expected the second undo to restore a, got %+v", restored)
+		}
+	})
+}
+
+func TestStorage_TrashEvicted(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		first, _ := store.Add(Clip{Content: "content 0", Type: "text", Timestamp: time.Now()})
+		for i := 1; i <= 5; i++ {
+			store.Add(Clip{Content: "content " + string(rune('0'+i)), Type: "text", Timestamp: time.Now()})
+		}
+
+		trash := store.Trash()
+		if len(trash) != 1 || trash[0].ID != first || trash[0].Reason != ReasonEvicted {
+			t.Fatalf("Expected clip %d in the trash as evicted, got %+v", first, trash)
+		}
+		// Evictions are not undone, only restored by ID
+		if _, err := store.Undo(); !errors.Is(err, ErrNothingToUndo) {
+			t.Fatalf("Expected ErrNothingToUndo, got %v", err)
+		}
+	})
+}
+
+func TestStorage_TrashSize(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		store.SetTrashSize(2)
+		for _, content := range []string{"a", "b", "c"} {
+			store.Add(Clip{Content: content, Type: "text", Timestamp: time.Now()})
+		}
+		store.Clear(false)
+
+		// The most recent clips survive trimming
+		trash := store.Trash()
+		if len(trash) != 2 || trash[0].Content != "c" || trash[1].Content != "b" {
+			t.Fatalf("Expected trash [c b], got %+v", trash)
+		}
+
+		store.SetTrashSize(0)
+		if len(store.Trash()) != 0 {
+			t.Fatalf("Expected no trash when disabled, got %+v", store.Trash())
+		}
+	})
+}
+
+func TestStorage_SearchRanking(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		pinned, _ := store.Add(Clip{Content: "meeting notes", Type: "text", Timestamp: time.Now()})
+		store.Pin(pinned)
+		best, _ := store.Add(Clip{Content: "docker ps", Type: "text", Timestamp: time.Now()})
+		store.Add(Clip{Content: "unrelated", Type: "text", Timestamp: time.Now()})
+		recent, _ := store.Add(Clip{Content: "do it quickly please", Type: "text", Timestamp: time.Now()})
+
+		results, err := store.Search("dps", 10)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 matches, got %+v", results)
+		}
+		// The tight word-start match wins over the more recent sprawling one
+		if results[0].ID != best {
+			t.Fatalf("Expected clip %d first, got %+v", best, results)
+		}
+		if !reflect.DeepEqual(results[0].Positions, []int{0, 7, 8}) {
+			t.Fatalf("Expected positions [0 7 8], got %v", results[0].Positions)
+		}
+		if results[1].ID != recent {
+			t.Fatalf("Expected clip %d second, got %+v", recent, results)
+		}
+
+		// With nothing to tell the matches apart, pins come first, then recency
+		results, _ = store.Search("", 10)
+		if len(results) != 4 || results[0].ID != pinned || results[1].ID != recent {
+			t.Fatalf("Expected the pin then the most recent clip first, got %+v", results)
+		}
+
+		if results, _ := store.Search("", 2); len(results) != 2 {
+			t.Fatalf("Expected the limit to apply, got %d results", len(results))
+		}
+	})
+}
+
+func TestStorage_SearchVerbatimFirst(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		verbatim, _ := store.Add(Clip{Content: "kubectl get pods", Type: "text", Timestamp: time.Now()})
+		fuzzy, _ := store.Add(Clip{Content: "kube: ctl", Type: "text", Timestamp: time.Now()})
+
+		// Enough clips contain the word as it is, so the fuzzy match is left out
+		results, _ := store.Search("kubectl", 1)
+		if len(results) != 1 || results[0].ID != verbatim {
+			t.Fatalf("Expected only clip %d, got %+v", verbatim, results)
+		}
+		if !reflect.DeepEqual(results[0].Positions, []int{0, 1, 2, 3, 4, 5, 6}) {
+			t.Fatalf("Expected positions 0 to 6, got %v", results[0].Positions)
+		}
+
+		// Too few do, so the fuzzy matches fill the results
+		results, _ = store.Search("kubectl", 10)
+		if len(results) != 2 {
+			t.Fatalf("Expected clips %d and %d, got %+v", verbatim, fuzzy, results)
+		}
+		if results, _ := store.Search("kbctl", 10); len(results) != 2 {
+			t.Fatalf("Expected both fuzzy matches, got %+v", results)
+		}
+	})
+}
+
+func TestStorage_DedupModes(t *testing.T) {
+	tests := []struct {
+		mode    DedupMode
+		repeats []string // each copied right after "Foo  bar", then "other"
+		hits    int
+	}{
+		{DedupExact, []string{"Foo  bar", "Foo bar", "foo  bar"}, 1},
+		{DedupWhitespace, []string{"Foo  bar", " Foo bar\n", "foo bar"}, 2},
+		{DedupCaseInsensitive, []string{"Foo  bar", "FOO  BAR", "foo bar"}, 2},
+		{DedupConsecutive, []string{"Foo  bar", "Foo  bar"}, 1},
 	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, store *Storage) {
+				store.SetMaxMemory(20)
+				if err := store.SetDedupMode(tt.mode); err != nil {
+					t.Fatalf("Failed to set dedup mode: %v", err)
+				}
+				first, _ := store.Add(Clip{Content: "Foo  bar", Type: "text", Timestamp: time.Now()})
+				copied := time.Now().Add(time.Minute)
+				id, _ := store.Add(Clip{Content: tt.repeats[0], Type: "text", Timestamp: copied})
+				for _, content := range tt.repeats[1:] {
+					store.Add(Clip{Content: "other", Type: "text", Timestamp: time.Now()})
+					store.Add(Clip{Content: content, Type: "text", Timestamp: time.Now()})
+				}
+				if id != first {
+					t.Fatalf("Expected an immediate repeat to dedup to %d, got %d", first, id)
+				}
 
-	if len(clips) != 0 {
-		t.Fatalf("Expected 0 clips after clear, got %d", len(clips))
+				clip, _ := store.Get(first)
+				if clip.Hits != tt.hits || clip.Content != "Foo  bar" || clip.LastCopied.IsZero() {
+					t.Fatalf("Expected %d hits on the original content, got %+v", tt.hits, clip)
+				}
+				clips, _ := store.List(20)
+				if want := len(tt.repeats) + 2 - tt.hits; len(clips) != want {
+					t.Fatalf("Expected %d clips, got %d", want, len(clips))
+				}
+			})
+		})
 	}
+}
+
+func TestStorage_DedupHitMovesToFront(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		store.SetDedupMode(DedupWhitespace)
+		first, _ := store.Add(Clip{Content: "foo", Type: "text", Timestamp: time.Now()})
+		store.Add(Clip{Content: "bar", Type: "text", Timestamp: time.Now()})
+		copied := time.Now().Add(time.Hour)
+		store.Add(Clip{Content: "foo\n", Type: "text", Timestamp: copied})
+
+		clips, _ := store.List(10)
+		if len(clips) != 2 || clips[0].ID != first {
+			t.Fatalf("Expected clip %d first, got %+v", first, clips)
+		}
+		if clips[0].Hits != 1 || !clips[0].LastCopied.Equal(copied) {
+			t.Fatalf("Expected 1 hit last copied at %v, got %d at %v", copied, clips[0].Hits, clips[0].LastCopied)
+		}
+	})
+}
+
+func TestStorage_RecordCopy(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		first, _ := store.Add(Clip{Content: "first", Type: "text", Timestamp: time.Now()})
+		store.Add(Clip{Content: "second", Type: "text", Timestamp: time.Now()})
+
+		used := time.Now().Add(time.Minute)
+		clip, err := store.RecordCopy(first, used)
+		if err != nil {
+			t.Fatalf("Failed to record copy: %v", err)
+		}
+		if clip.ID != first || clip.Copies != 1 || !clip.LastUsed.Equal(used) {
+			t.Fatalf("Expected clip %d used once at %v, got %+v", first, used, clip)
+		}
+
+		clips, _ := store.List(10)
+		if len(clips) != 2 || clips[0].ID != first || clips[0].Copies != 1 {
+			t.Fatalf("Expected the copied clip first, got %+v", clips)
+		}
+		if results, _ := store.Search("first", 10); len(results) != 1 || results[0].ID != first {
+			t.Fatalf("Expected the copied clip to stay searchable, got %+v", results)
+		}
+
+		if _, err := store.RecordCopy(99, used); err == nil {
+			t.Fatal("Expected an error recording a copy of a missing clip")
+		}
+
+		// Consecutive dedup counts the copy but leaves the clip in place
+		if err := store.SetDedupMode(DedupConsecutive); err != nil {
+			t.Fatalf("Failed to set dedup mode: %v", err)
+		}
+		second := clips[1].ID
+		if clip, err := store.RecordCopy(second, used); err != nil || clip.Copies != 1 {
+			t.Fatalf("Expected clip %d used once, got %+v, %v", second, clip, err)
+		}
+		clips, _ = store.List(10)
+		if len(clips) != 2 || clips[0].ID != first || clips[1].Copies != 1 {
+			t.Fatalf("Expected clip %d to stay second, got %+v", second, clips)
+		}
+	})
+}
+
+func TestStorage_ListSorted(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		snippet, _ := store.Add(Clip{Content: "snippet", Type: "text", Timestamp: time.Now()})
+		pinned, _ := store.Add(Clip{Content: "pinned", Type: "text", Timestamp: time.Now()})
+		store.Pin(pinned)
+		recent, _ := store.Add(Clip{Content: "recent", Type: "text", Timestamp: time.Now()})
+		for i := 0; i < 2; i++ {
+			store.RecordCopy(snippet, time.Now())
+		}
+		store.Add(Clip{Content: "recent", Type: "text", Timestamp: time.Now()}) // a second capture
 
-	pinned, _ := store.GetPinned()
-	if len(pinned) != 0 {
-		t.Fatalf("Expected 0 pinned clips after clear, got %d", len(pinned))
+		ids := func(order SortOrder) []int64 {
+			clips, err := store.ListSorted(10, order)
+			if err != nil {
+				t.Fatalf("Failed to list: %v", err)
+			}
+			var ids []int64
+			for _, clip := range clips {
+				ids = append(ids, clip.ID)
+			}
+			return ids
+		}
+		if got := ids(SortRecent); !reflect.DeepEqual(got, []int64{recent, snippet, pinned}) {
+			t.Fatalf("Expected recent order [%d %d %d], got %v", recent, snippet, pinned, got)
+		}
+		if got := ids(SortFrecency); !reflect.DeepEqual(got, []int64{snippet, recent, pinned}) {
+			t.Fatalf("Expected frecency order [%d %d %d], got %v", snippet, recent, pinned, got)
+		}
+		if got := ids(SortPinnedFirst); !reflect.DeepEqual(got, []int64{pinned, recent, snippet}) {
+			t.Fatalf("Expected pinned first [%d %d %d], got %v", pinned, recent, snippet, got)
+		}
+
+		results, _ := store.SearchSorted("e", 10, SortFrecency)
+		if len(results) != 3 || results[0].ID != snippet {
+			t.Fatalf("Expected the most used match first, got %+v", results)
+		}
+		if clips, _ := store.ListSorted(1, SortPinnedFirst); len(clips) != 1 {
+			t.Fatalf("Expected the limit to apply, got %d clips", len(clips))
+		}
+	})
+}
+
+func TestClip_Frecency(t *testing.T) {
+	now := time.Now()
+	fresh := Clip{Timestamp: now}
+	if got := fresh.Frecency(now); got != 1 {
+		t.Errorf("Expected a fresh clip to score 1, got %v", got)
+	}
+	used := Clip{Timestamp: now.Add(-30 * 24 * time.Hour), Hits: 1, Copies: 2, LastUsed: now.Add(-frecencyHalfLife)}
+	if got := used.Frecency(now); got != 3 {
+		t.Errorf("Expected 6 uses halved once to score 3, got %v", got)
+	}
+	if got := used.Frecency(now.Add(frecencyHalfLife)); got != 1.5 {
+		t.Errorf("Expected the score to halve again, got %v", got)
 	}
 }
 
-func TestStorage_MemoryEviction(t *testing.T) {
-	store, cleanup := setupTestStorage()
-	defer cleanup()
+func TestStorage_Tags(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		a, _ := store.Add(Clip{Content: "select 1", Type: "text", Timestamp: time.Now()})
+		b, _ := store.Add(Clip{Content: "select 2", Type: "text", Timestamp: time.Now()})
 
-	// Add 5 clips (exceeds memory limit of 5)
-	for i := 0; i < 5; i++ {
-		clip := Clip{
-			Content:   "content " + string(rune('a'+i)),
-			Type:      "text",
-			Timestamp: time.Now(),
-			Pinned:    false,
+		clip, err := store.Tag(a, []string{"work", " SQL", "work"})
+		if err != nil {
+			t.Fatalf("Failed to tag: %v", err)
 		}
-		store.Add(clip)
+		if !reflect.DeepEqual(clip.Tags, []string{"sql", "work"}) {
+			t.Fatalf("Expected tags [sql work], got %v", clip.Tags)
+		}
+		store.Tag(b, []string{"work"})
+		if _, err := store.Tag(a, []string{"two words"}); err == nil {
+			t.Fatal("Expected an error for an invalid tag")
+		}
+
+		tags, _ := store.Tags()
+		if want := []TagCount{{"sql", 1}, {"work", 2}}; !reflect.DeepEqual(tags, want) {
+			t.Fatalf("Expected %v, got %v", want, tags)
+		}
+		if results, _ := store.Search("tag:work select", 10); len(results) != 2 {
+			t.Fatalf("Expected 2 clips tagged work, got %+v", results)
+		}
+
+		clip, _ = store.Untag(a, []string{"work"})
+		if !reflect.DeepEqual(clip.Tags, []string{"sql"}) {
+			t.Fatalf("Expected tags [sql] after untagging work, got %v", clip.Tags)
+		}
+		store.Untag(b, nil)
+		if stored, _ := store.Get(b); len(stored.Tags) != 0 {
+			t.Fatalf("Expected untag without tags to remove them all, got %v", stored.Tags)
+		}
+		if _, err := store.Tag(99, []string{"work"}); err == nil {
+			t.Fatal("Expected an error tagging a missing clip")
+		}
+	})
+}
+
+func TestStorage_ProtectTagged(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store *Storage) {
+		if err := store.SetProtectTagged(true); err != nil {
+			t.Fatalf("Failed to protect tagged clips: %v", err)
+		}
+		tagged, _ := store.Add(Clip{Content: "snippet", Type: "text", Timestamp: time.Now()})
+		store.Tag(tagged, []string{"project"})
+		for i := 0; i < 5; i++ {
+			store.Add(Clip{Content: "content " + string(rune('a'+i)), Type: "text", Timestamp: time.Now()})
+		}
+		if _, err := store.Get(tagged); err != nil {
+			t.Fatal("Expected the tagged clip to survive eviction")
+		}
+
+		// Unprotected, it is the oldest and goes first
+		store.SetProtectTagged(false)
+		store.Add(Clip{Content: "content f", Type: "text", Timestamp: time.Now()})
+		if _, err := store.Get(tagged); err == nil {
+			t.Fatal("Expected the tagged clip to be evicted once unprotected")
+		}
+	})
+}
+
+// benchClips is the history size the benchmarks run against
+const benchClips = 100_000
+
+// benchHistory is storage filled once and shared, as filling it is slow
+type benchHistory struct {
+	once  sync.Once
+	store *Storage
+}
+
+var (
+	searchHistory benchHistory // only searched, so the same for every search benchmark
+	addHistory    benchHistory // BenchmarkStorage_Add's own, as adding evicts clips
+)
+
+// benchStorage returns h's memory storage, holding benchClips clips of
+// random words
+func benchStorage(b *testing.B, h *benchHistory) *Storage {
+	b.Helper()
+	h.once.Do(func() {
+		words := []string{
+			"docker", "kubectl", "git", "push", "origin", "main", "select", "from",
+			"where", "users", "http", "localhost", "config", "yaml", "deploy",
+			"error", "token", "meeting", "notes", "review", "build", "release",
+		}
+		rng := rand.New(rand.NewSource(1))
+		h.store, _ = NewStorage(benchClips)
+		for i := 0; i < benchClips; i++ {
+			var content strings.Builder
+			for n := 3 + rng.Intn(8); n > 0; n-- {
+				content.WriteString(words[rng.Intn(len(words))])
+				content.WriteByte(' ')
+			}
+			fmt.Fprintf(&content, "#%d", i)
+			h.store.Add(Clip{Content: content.String(), Type: "text", Timestamp: time.Now()})
+		}
+	})
+	b.ResetTimer()
+	return h.store
+}
+
+func BenchmarkStorage_SearchPhrase(b *testing.B) {
+	store := benchStorage(b, &searchHistory)
+	for i := 0; i < b.N; i++ {
+		store.Search(`"#4242"`, 50)
 	}
+}
 
-	// Add one more clip
-	clip := Clip{
-		Content:   "extra content",
-		Type:      "text",
-		Timestamp: time.Now(),
-		Pinned:    false,
+func BenchmarkStorage_SearchWord(b *testing.B) {
+	store := benchStorage(b, &searchHistory)
+	for i := 0; i < b.N; i++ {
+		store.Search("kubectl deploy", 50)
 	}
-	store.Add(clip)
+}
 
-	// Only last 5 should remain
-	clips, err := store.List(10)
-	if err != nil {
-		t.Fatalf("Failed to list clips: %v", err)
+// BenchmarkStorage_SearchScan is the baseline: a filter the index cannot
+// narrow, so every clip is checked
+func BenchmarkStorage_SearchScan(b *testing.B) {
+	store := benchStorage(b, &searchHistory)
+	for i := 0; i < b.N; i++ {
+		store.Search("len>300", 50)
 	}
+}
 
-	if len(clips) != 5 {
-		t.Fatalf("Expected 5 clips (memory limit), got %d", len(clips))
+func BenchmarkStorage_Add(b *testing.B) {
+	store := benchStorage(b, &addHistory)
+	for i := 0; i < b.N; i++ {
+		store.Add(Clip{Content: fmt.Sprintf("git push origin feature-%d", i), Type: "text", Timestamp: time.Now()})
 	}
 }
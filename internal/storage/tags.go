@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// TagCount is a tag and how many clips carry it
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// NormalizeTag returns tag lower-cased and trimmed, or an error if it is
+// empty or holds characters other than letters, digits and - _ . /
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", fmt.Errorf("empty tag")
+	}
+	for _, r := range tag {
+		if !isTagRune(r) {
+			return "", fmt.Errorf("invalid tag %q: use letters, digits and - _ . /", tag)
+		}
+	}
+	return tag, nil
+}
+
+// normalizeTags normalizes every tag, failing on the first invalid one
+func normalizeTags(tags []string) ([]string, error) {
+	out := make([]string, len(tags))
+	for i, tag := range tags {
+		var err error
+		if out[i], err = NormalizeTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// HasTag reports whether the clip carries tag (already normalized)
+func (c Clip) HasTag(tag string) bool {
+	i := sort.SearchStrings(c.Tags, tag)
+	return i < len(c.Tags) && c.Tags[i] == tag
+}
+
+// mergeTags returns the sorted union of tags and more
+func mergeTags(tags, more []string) []string {
+	merged := append(append([]string(nil), tags...), more...)
+	sort.Strings(merged)
+	out := merged[:0]
+	for _, tag := range merged {
+		if len(out) == 0 || tag != out[len(out)-1] {
+			out = append(out, tag)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// Tag adds tags to a clip and returns it
+func (s *Storage) Tag(id int64, tags []string) (Clip, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return Clip{}, err
+	}
+	return s.retag(id, func(clip Clip) []string { return mergeTags(clip.Tags, tags) })
+}
+
+// Untag removes tags from a clip, or all of them if none are given, and
+// returns it
+func (s *Storage) Untag(id int64, tags []string) (Clip, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return Clip{}, err
+	}
+	return s.retag(id, func(clip Clip) []string {
+		var kept []string
+		for _, tag := range clip.Tags {
+			if len(tags) > 0 && !slices.Contains(tags, tag) {
+				kept = append(kept, tag)
+			}
+		}
+		return kept
+	})
+}
+
+// retag replaces a clip's tags with what change makes of them
+func (s *Storage) retag(id int64, change func(Clip) []string) (Clip, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clip, exists := s.backend.Get(id)
+	if !exists {
+		return Clip{}, fmt.Errorf("clip %d not found", id)
+	}
+	clip.Tags = change(clip)
+	s.update(clip)
+	// Untagging may leave more unprotected clips than fit
+	s.evictOverflow()
+	return clip, s.backendErr()
+}
+
+// Tags returns every tag in use with its number of clips, by name
+func (s *Storage) Tags() ([]TagCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	s.backend.Each(func(clip Clip) bool {
+		for _, tag := range clip.Tags {
+			counts[tag]++
+		}
+		return true
+	})
+	tags := make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, TagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, s.backendErr()
+}
+
+// SetProtectTagged sets whether tagged clips are kept from eviction like
+// pinned ones. Turning it off may evict clips right away.
+func (s *Storage) SetProtectTagged(protect bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	guard, ok := s.backend.(evictionGuard)
+	if !ok {
+		if protect {
+			return fmt.Errorf("backend can't protect tagged clips from eviction")
+		}
+		return nil
+	}
+	guard.SetProtectTagged(protect)
+	s.evictOverflow()
+	return s.backendErr()
+}
+
+// isTagRune reports whether r may appear in a tag
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./", r)
+}
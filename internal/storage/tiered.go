@@ -0,0 +1,156 @@
+package storage
+
+import "sync"
+
+// TieredStore keeps the most recent clips in a hot in-memory tier and every
+// clip in a cold on-disk tier. Writes go through to disk; reads are served
+// from memory when the hot tier can answer them.
+type TieredStore struct {
+	hot     *MemoryStore
+	cold    *SQLiteStore
+	hotSize int
+	mu      sync.Mutex
+}
+
+// NewTieredStore creates a tiered store over cold, caching up to hotSize recent clips
+func NewTieredStore(cold *SQLiteStore, hotSize int) *TieredStore {
+	t := &TieredStore{
+		hot:     NewMemoryStore(),
+		cold:    cold,
+		hotSize: hotSize,
+	}
+
+	// Warm the hot tier, oldest first so recency order is preserved
+	recent := cold.List(hotSize)
+	for i := len(recent) - 1; i >= 0; i-- {
+		t.hot.Add(recent[i])
+	}
+
+	return t
+}
+
+// Add writes a clip to disk and caches it as the most recent hot clip
+func (t *TieredStore) Add(clip Clip) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id, err := t.cold.Add(clip)
+	if err != nil {
+		return 0, err
+	}
+
+	// A duplicate may have been cold only; cache the stored version
+	stored, ok := t.cold.Get(id)
+	if !ok {
+		return id, nil
+	}
+	if _, err := t.hot.Add(stored); err != nil {
+		return id, err
+	}
+	for t.hot.Count() > t.hotSize {
+		t.hot.removeOldest()
+	}
+
+	return id, nil
+}
+
+// SetDedup turns deduplication in Add on or off in both tiers
+func (t *TieredStore) SetDedup(enabled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hot.SetDedup(enabled)
+	t.cold.SetDedup(enabled)
+}
+
+// SetProtectTagged sets whether eviction skips tagged clips as well
+func (t *TieredStore) SetProtectTagged(protect bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hot.SetProtectTagged(protect)
+	t.cold.SetProtectTagged(protect)
+}
+
+// Get retrieves a clip by ID, falling back to disk
+func (t *TieredStore) Get(id int64) (Clip, bool) {
+	if clip, ok := t.hot.Get(id); ok {
+		return clip, true
+	}
+	return t.cold.Get(id)
+}
+
+// List returns recent clips (most recent first).
+// The hot tier always holds a prefix of the full history, so it answers any
+// limit it can cover.
+func (t *TieredStore) List(limit int) []Clip {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit <= t.hot.Count() {
+		return t.hot.List(limit)
+	}
+	return t.cold.List(limit)
+}
+
+// Each iterates every clip from disk, most recent first
+func (t *TieredStore) Each(fn func(Clip) bool) {
+	t.cold.Each(fn)
+}
+
+// Update writes a modified clip to both tiers
+func (t *TieredStore) Update(clip Clip) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.hot.Update(clip)
+	return t.cold.Update(clip)
+}
+
+// Remove deletes a clip from both tiers
+func (t *TieredStore) Remove(id int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.hot.Remove(id)
+	return t.cold.Remove(id)
+}
+
+// EvictOldest removes the oldest unpinned clip from both tiers
+func (t *TieredStore) EvictOldest() (Clip, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	clip, ok := t.cold.EvictOldest()
+	if ok {
+		t.hot.Remove(clip.ID)
+	}
+	return clip, ok
+}
+
+// Count returns the number of clips on disk
+func (t *TieredStore) Count() int {
+	return t.cold.Count()
+}
+
+// Bytes returns the total Size of the clips on disk
+func (t *TieredStore) Bytes() int64 {
+	return t.cold.Bytes()
+}
+
+// Clear removes all clips from both tiers
+func (t *TieredStore) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.hot.Clear()
+	t.cold.Clear()
+}
+
+// Err returns the most recent disk error and resets it
+func (t *TieredStore) Err() error {
+	return t.cold.Err()
+}
+
+// Close closes the disk tier
+func (t *TieredStore) Close() error {
+	return t.cold.Close()
+}
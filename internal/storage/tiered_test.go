@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestTieredStore(t *testing.T, hotSize int) *TieredStore {
+	disk, err := NewSQLiteStore(filepath.Join(t.TempDir(), "clipnest.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	store := NewTieredStore(disk, hotSize)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestTieredStore_HotTierHoldsMostRecent(t *testing.T) {
+	store := newTestTieredStore(t, 2)
+
+	var ids []int64
+	for i := 0; i < 4; i++ {
+		id, err := store.Add(Clip{Content: "content " + string(rune('a'+i)), Type: "text", Timestamp: time.Now()})
+		if err != nil {
+			t.Fatalf("Failed to add clip: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if store.hot.Count() != 2 {
+		t.Fatalf("Expected 2 hot clips, got %d", store.hot.Count())
+	}
+	if store.Count() != 4 {
+		t.Fatalf("Expected 4 clips on disk, got %d", store.Count())
+	}
+
+	// Cold clips are still reachable
+	clip, ok := store.Get(ids[0])
+	if !ok || clip.Content != "content a" {
+		t.Fatalf("Expected cold clip 'content a', got %+v (found=%v)", clip, ok)
+	}
+
+	// Lists beyond the hot tier come from disk in the same order
+	clips := store.List(4)
+	if len(clips) != 4 || clips[0].Content != "content d" || clips[3].Content != "content a" {
+		t.Fatalf("Unexpected list order: %+v", clips)
+	}
+}
+
+func TestTieredStore_DuplicateOfColdClipBecomesHot(t *testing.T) {
+	store := newTestTieredStore(t, 1)
+
+	first, _ := store.Add(Clip{Content: "first", Type: "text", Timestamp: time.Now()})
+	store.Add(Clip{Content: "second", Type: "text", Timestamp: time.Now()})
+
+	id, _ := store.Add(Clip{Content: "first", Type: "text", Timestamp: time.Now()})
+	if id != first {
+		t.Fatalf("Expected duplicate to keep ID %d, got %d", first, id)
+	}
+
+	clips := store.List(1)
+	if len(clips) != 1 || clips[0].ID != first {
+		t.Fatalf("Expected re-copied clip at the front, got %+v", clips)
+	}
+}
+
+func TestTieredStore_EvictOldestUpdatesBothTiers(t *testing.T) {
+	store := newTestTieredStore(t, 5)
+
+	id, _ := store.Add(Clip{Content: "old", Type: "text", Timestamp: time.Now()})
+	store.Add(Clip{Content: "new", Type: "text", Timestamp: time.Now()})
+
+	if evicted, ok := store.EvictOldest(); !ok || evicted.ID != id {
+		t.Fatal("Expected eviction to succeed")
+	}
+	if _, ok := store.Get(id); ok {
+		t.Fatal("Evicted clip is still reachable")
+	}
+	if store.hot.Count() != 1 {
+		t.Fatalf("Expected 1 hot clip after eviction, got %d", store.hot.Count())
+	}
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reasons a clip went to the trash
+const (
+	ReasonDeleted = "deleted"
+	ReasonCleared = "cleared"
+	ReasonEvicted = "evicted"
+)
+
+// DefaultTrashSize is how many removed clips Storage keeps until SetTrashSize
+const DefaultTrashSize = 100
+
+// ErrNothingToUndo is returned by Undo when the trash holds no delete or clear
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// TrashedClip is a removed clip kept so it can be restored
+type TrashedClip struct {
+	Clip
+	Reason    string // ReasonDeleted, ReasonCleared or ReasonEvicted
+	RemovedAt time.Time
+
+	op int64 // clips removed by the same delete or clear share an op
+}
+
+// trashClips records clips, oldest first, as one removal and drops the
+// oldest trash entries over the limit. Callers hold s.mu.
+func (s *Storage) trashClips(clips []Clip, reason string, now time.Time) {
+	if len(clips) == 0 || s.trashSize == 0 {
+		return
+	}
+	s.lastOp++
+	for _, clip := range clips {
+		s.trash = append(s.trash, TrashedClip{Clip: clip, Reason: reason, RemovedAt: now, op: s.lastOp})
+	}
+	s.trimTrash()
+}
+
+// trimTrash drops the oldest entries over trashSize. Callers hold s.mu.
+func (s *Storage) trimTrash() {
+	if over := len(s.trash) - s.trashSize; over > 0 {
+		s.trash = append([]TrashedClip(nil), s.trash[over:]...)
+	}
+}
+
+// SetTrashSize changes how many removed clips the trash keeps; 0 disables it
+func (s *Storage) SetTrashSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trashSize = size
+	s.trimTrash()
+}
+
+// Trash returns the removed clips, most recently removed first
+func (s *Storage) Trash() []TrashedClip {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	trash := make([]TrashedClip, len(s.trash))
+	for i, entry := range s.trash {
+		trash[len(s.trash)-1-i] = entry
+	}
+	return trash
+}
+
+// Restore brings a clip back from the trash with its original ID and pin
+func (s *Storage) Restore(id int64) (Clip, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.trash) - 1; i >= 0; i-- {
+		if s.trash[i].ID == id {
+			restored, err := s.restoreEntries([]int{i})
+			if err != nil {
+				return Clip{}, err
+			}
+			return restored[0], nil
+		}
+	}
+	return Clip{}, fmt.Errorf("clip %d not in trash", id)
+}
+
+// Undo restores every clip of the most recent delete or clear still in the
+// trash and returns them, most recent first
+func (s *Storage) Undo() ([]Clip, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var op int64
+	for i := len(s.trash) - 1; i >= 0; i-- {
+		if s.trash[i].Reason != ReasonEvicted {
+			op = s.trash[i].op
+			break
+		}
+	}
+	if op == 0 {
+		return nil, ErrNothingToUndo
+	}
+
+	var entries []int
+	for i, entry := range s.trash {
+		if entry.op == op {
+			entries = append(entries, i)
+		}
+	}
+	restored, err := s.restoreEntries(entries)
+	for i, j := 0, len(restored)-1; i < j; i, j = i+1, j-1 {
+		restored[i], restored[j] = restored[j], restored[i]
+	}
+	return restored, err
+}
+
+// restoreEntries adds the trash entries at the given ascending indexes back
+// to the backend, in order, and takes them out of the trash. A clip whose
+// content was captured again in the meantime merges into that clip.
+// It stops at the first failure. Callers hold s.mu.
+func (s *Storage) restoreEntries(indexes []int) ([]Clip, error) {
+	restored := make([]Clip, 0, len(indexes))
+	var err error
+	for n, i := range indexes {
+		clip := s.trash[i].Clip
+		var id int64
+		if id, err = s.backend.Add(clip); err != nil {
+			indexes = indexes[:n]
+			break
+		}
+		added := clip
+		added.ID = id
+		s.index.touch(added)
+		if id != clip.ID {
+			// Merged into a clip with the same content: keep its pin and tags
+			existing, _ := s.backend.Get(id)
+			merged := existing
+			merged.Pinned = existing.Pinned || clip.Pinned
+			merged.Tags = mergeTags(existing.Tags, clip.Tags)
+			if merged.Pinned != existing.Pinned || len(merged.Tags) != len(existing.Tags) {
+				s.update(merged)
+			}
+			clip = merged
+		}
+		restored = append(restored, clip)
+	}
+
+	for n := len(indexes) - 1; n >= 0; n-- {
+		i := indexes[n]
+		s.trash = append(s.trash[:i], s.trash[i+1:]...)
+	}
+
+	// Restoring can push the history over its limits again
+	s.evictOverflow()
+	if err != nil {
+		return restored, fmt.Errorf("failed to restore clip: %w", err)
+	}
+	return restored, s.backendErr()
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// SortOrder is an order for listing or searching clips
+type SortOrder string
+
+const (
+	SortRelevance   SortOrder = "relevance"    // best matches first; for a list, the same as recent
+	SortRecent      SortOrder = "recent"       // most recently captured or copied first
+	SortFrecency    SortOrder = "frecency"     // most used, weighted by how recently, first
+	SortPinnedFirst SortOrder = "pinned-first" // pinned clips first, then the rest, each most recent first
+)
+
+// ParseSortOrder parses a sort order by name; empty means def
+func ParseSortOrder(name string, def SortOrder) (SortOrder, error) {
+	switch order := SortOrder(name); order {
+	case "":
+		return def, nil
+	case SortRelevance, SortRecent, SortFrecency, SortPinnedFirst:
+		return order, nil
+	}
+	return "", fmt.Errorf("unknown sort order %q (want %s, %s, %s or %s)",
+		name, SortRelevance, SortRecent, SortFrecency, SortPinnedFirst)
+}
+
+// Frecency weighs a clip's uses by how recent the last one was
+const (
+	frecencyCopyWeight = 2                  // a copy from history counts as much as this many captures
+	frecencyHalfLife   = 7 * 24 * time.Hour // idle time after which the score has halved
+)
+
+// Captures returns how often the clip was captured, including the first time
+func (c Clip) Captures() int {
+	return c.Hits + 1
+}
+
+// LastActive returns when the clip was last captured or copied from history
+func (c Clip) LastActive() time.Time {
+	last := c.Timestamp
+	for _, t := range []time.Time{c.LastCopied, c.LastUsed} {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// Frecency scores how much the clip is used: its captures and copies from
+// history, halving for every frecencyHalfLife it has been idle at now
+func (c Clip) Frecency(now time.Time) float64 {
+	uses := float64(c.Captures() + frecencyCopyWeight*c.Copies)
+	idle := max(now.Sub(c.LastActive()), 0)
+	return uses * math.Exp2(-float64(idle)/float64(frecencyHalfLife))
+}
+
+// RecordCopy notes that the clip with id was copied from history at at, and
+// makes it the most recent clip. Under consecutive dedup it keeps its place,
+// as the backend then never moves a clip to the front.
+func (s *Storage) RecordCopy(id int64, at time.Time) (Clip, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clip, exists := s.backend.Get(id)
+	if !exists {
+		return Clip{}, fmt.Errorf("clip %d not found", id)
+	}
+	clip.Copies++
+	clip.LastUsed = at
+	s.update(clip)
+
+	if s.dedup != DedupConsecutive {
+		if _, err := s.backend.Add(clip); err != nil { // a duplicate, so it moves to the front
+			return Clip{}, err
+		}
+		s.index.touch(clip)
+	}
+	return clip, s.backendErr()
+}
+
+// ListSorted returns up to limit clips in order
+func (s *Storage) ListSorted(limit int, order SortOrder) ([]Clip, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var clips []Clip
+	switch order {
+	case SortFrecency:
+		s.backend.Each(func(clip Clip) bool {
+			clips = append(clips, clip)
+			return true
+		})
+		now := time.Now()
+		sort.SliceStable(clips, func(i, j int) bool { return clips[i].Frecency(now) > clips[j].Frecency(now) })
+		if len(clips) > limit {
+			clips = clips[:limit]
+		}
+	case SortPinnedFirst:
+		for _, id := range s.index.pinnedIDs() {
+			if clip, exists := s.backend.Get(id); exists && len(clips) < limit {
+				clips = append(clips, clip)
+			}
+		}
+		s.backend.Each(func(clip Clip) bool {
+			if len(clips) >= limit {
+				return false
+			}
+			if !clip.Pinned {
+				clips = append(clips, clip)
+			}
+			return true
+		})
+	default:
+		clips = s.backend.List(limit)
+	}
+	return clips, s.backendErr()
+}
+
+// sortMatches reorders matches, which are in relevance order, by order
+func sortMatches(matches []Match, order SortOrder, now time.Time) {
+	switch order {
+	case SortRecent:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].age < matches[j].age })
+	case SortFrecency:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].Frecency(now) > matches[j].Frecency(now) })
+	case SortPinnedFirst:
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].Pinned && !matches[j].Pinned })
+	}
+}